@@ -0,0 +1,132 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Checksummer is a Migration that has a checksum of its contents. The checksum
+// is stored in the migrations table when the migration is applied and is
+// checked by Verify.
+type Checksummer interface {
+	Migration
+
+	Checksum() string
+}
+
+// checksumOf returns the checksum of m or nil if m isn't a Checksummer.
+func checksumOf(m Migration) interface{} {
+	if c, ok := m.(Checksummer); ok {
+		return c.Checksum()
+	}
+	return nil
+}
+
+// ErrChecksumMismatch is returned by Verify when applied migrations were
+// changed after they had been applied.
+type ErrChecksumMismatch struct {
+	Names []string
+}
+
+// Error implements the error interface for ErrChecksumMismatch.
+func (err ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("migration checksum mismatch: %s", strings.Join(err.Names, ", "))
+}
+
+var _ error = ErrChecksumMismatch{}
+
+// Verify checks that checksums of applied Checksummer migrations match the
+// ones stored in the migrations table. Migrations applied without a checksum
+// are not checked.
+func (sch *Schema) Verify(migrations []Migration) error {
+	return sch.VerifyContext(context.Background(), migrations)
+}
+
+// VerifyContext is like Verify but uses ctx for the query.
+func (sch *Schema) VerifyContext(ctx context.Context, migrations []Migration) (err error) {
+	migByName, err := indexByName(migrations)
+	if err != nil {
+		return err
+	}
+
+	rows, err := sch.db.QueryContext(ctx, sch.queries.checksums)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		closeErr := rows.Close()
+		if closeErr != nil {
+			if err != nil {
+				err = ErrorPair{Err1: err, Err2: closeErr}
+			} else {
+				err = closeErr
+			}
+		}
+	}()
+
+	var mismatched []string
+	for rows.Next() {
+		var name string
+		var checksum sql.NullString
+		if err := rows.Scan(&name, &checksum); err != nil {
+			return err
+		}
+
+		c, ok := migByName[name].(Checksummer)
+		if ok && checksum.Valid && c.Checksum() != checksum.String {
+			mismatched = append(mismatched, name)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(mismatched) > 0 {
+		return ErrChecksumMismatch{Names: mismatched}
+	}
+
+	return nil
+}
+
+// SetHash returns a hex-encoded SHA-256 hash of migrations that doesn't depend
+// on their order. It covers every name along with the SQL of SQLer migrations
+// and the checksum of Checksummer ones, so storing it lets a deploy skip
+// migrating when nothing changed. It fails for sets that Apply would reject,
+// such as ones with nil migrations or duplicate names.
+func SetHash(migrations []Migration) (string, error) {
+	if err := validate(migrations); err != nil {
+		return "", err
+	}
+
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name() < sorted[j].Name()
+	})
+
+	h := sha256.New()
+	for _, m := range sorted {
+		var body string
+		if s, ok := m.(SQLer); ok {
+			body = s.UpSQL()
+		}
+		var checksum string
+		if c, ok := m.(Checksummer); ok {
+			checksum = c.Checksum()
+		}
+
+		// Length prefixes keep different sets from hashing the same bytes.
+		for _, part := range []string{m.Name(), body, checksum} {
+			fmt.Fprintf(h, "%d:%s", len(part), part)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
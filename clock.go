@@ -0,0 +1,23 @@
+package migration
+
+import "time"
+
+// Clock tells the time migrations are applied at.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+var _ Clock = realClock{}
+
+// SetClock sets the clock, e.g. to a fixed time in tests. A nil clock means
+// the real time, which is the default.
+func (sch *Schema) SetClock(c Clock) {
+	if c == nil {
+		c = realClock{}
+	}
+	sch.clock = c
+}
@@ -0,0 +1,44 @@
+package migration
+
+// ColumnConfig names the columns of the migrations table holding the
+// migration name and the time it was applied.
+type ColumnConfig struct {
+	Name      string
+	AppliedAt string
+}
+
+// DefaultColumnConfig is the default column configuration.
+var DefaultColumnConfig = ColumnConfig{
+	Name:      "name",
+	AppliedAt: "applied_at",
+}
+
+// SetColumns sets the names of the name and applied_at columns used by every
+// query of sch, including the table Init creates. Empty fields keep the
+// default names. The names are interpolated into queries, so it returns
+// ErrInvalidIdentifier unless they consist only of ASCII letters, digits and
+// underscores. Init and every query quote them, so their case is kept.
+func (sch *Schema) SetColumns(cfg ColumnConfig) error {
+	if cfg.Name == "" {
+		cfg.Name = DefaultColumnConfig.Name
+	}
+	if cfg.AppliedAt == "" {
+		cfg.AppliedAt = DefaultColumnConfig.AppliedAt
+	}
+
+	for _, name := range []string{cfg.Name, cfg.AppliedAt} {
+		if !isPlainIdent(name) {
+			return ErrInvalidIdentifier{Name: name}
+		}
+	}
+
+	sch.cols = cfg
+	sch.buildQueries()
+	return nil
+}
+
+// col returns the column name quoted by the dialect, the way Init creates the
+// column, so that queries refer to it whatever its case.
+func (sch *Schema) col(name string) string {
+	return sch.dialect.QuoteIdent(name)
+}
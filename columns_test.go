@@ -0,0 +1,55 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetColumnsQuoted(t *testing.T) {
+	db, fdb := newFakeDB(t)
+	sch := NewSchema(db, DefaultSchemaName, DefaultMigrationTableName)
+	cols := ColumnConfig{Name: "MigrationName", AppliedAt: "AppliedAt"}
+	if err := sch.SetColumns(cols); err != nil {
+		t.Fatal(err)
+	}
+
+	migs := testMigrations("1", "2")
+	if err := sch.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sch.Apply(migs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sch.FindUnrolled(migs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sch.ListApplied(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sch.Verify(migs); err != nil {
+		t.Fatal(err)
+	}
+	if err := sch.VerifyIntegrity(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sch.RollbackN(migs, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// PostgreSQL folds unquoted names to lower case, so a query only refers
+	// to the columns Init creates if it quotes them the same way.
+	var created bool
+	for _, q := range fdb.executed("") {
+		for _, name := range []string{cols.Name, cols.AppliedAt} {
+			if strings.Count(q, name) != strings.Count(q, `"`+name+`"`) {
+				t.Errorf("%s is not quoted in %s", name, q)
+			}
+		}
+		if strings.HasPrefix(q, "CREATE TABLE") && strings.Contains(q, `"MigrationName" TEXT UNIQUE`) {
+			created = true
+		}
+	}
+	if !created {
+		t.Error("Init didn't create the quoted column")
+	}
+}
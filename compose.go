@@ -0,0 +1,114 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Compose returns a migration named name made of subs. It applies them in
+// order and rolls them back in reverse order in the same transaction, and
+// only name is recorded in the migrations table. If a sub-migration fails,
+// the error is returned and the transaction is rolled back as for any other
+// migration. Sub-migrations get contexts and dry runs as if they were applied
+// on their own, but their names, tags and other optional interfaces are
+// ignored, except that the composite is irreversible if any of them is.
+// If some of subs is nil or NonTransactional, which can't run in the
+// transaction of the composite, applying or rolling it back returns
+// ErrNilMigration or ErrNonTransactional without running any of them.
+func Compose(name string, subs ...Migration) Migration {
+	var err error
+	for i, m := range subs {
+		if m == nil {
+			err = ErrNilMigration{Index: i}
+			break
+		}
+		if isNonTransactional(m) {
+			err = ErrNonTransactional{Name: m.Name()}
+			break
+		}
+	}
+
+	return composite{name: name, subs: append([]Migration(nil), subs...), err: err}
+}
+
+// composite is a Migration returned by Compose.
+type composite struct {
+	name string
+	subs []Migration
+	// err is the error of invalid subs, returned instead of running them.
+	err error
+}
+
+// Apply implements Migration for composite.
+func (c composite) Apply(tx *sql.Tx) error {
+	return c.ApplyContext(context.Background(), tx)
+}
+
+// Rollback implements Migration for composite.
+func (c composite) Rollback(tx *sql.Tx) error {
+	return c.RollbackContext(context.Background(), tx)
+}
+
+// Name implements Migration for composite.
+func (c composite) Name() string {
+	return c.name
+}
+
+// ApplyContext implements ContextMigration for composite.
+func (c composite) ApplyContext(ctx context.Context, tx *sql.Tx) error {
+	return c.apply(ctx, tx, false)
+}
+
+// RollbackContext implements ContextMigration for composite.
+func (c composite) RollbackContext(ctx context.Context, tx *sql.Tx) error {
+	return c.rollback(ctx, tx, false)
+}
+
+// ApplyDry implements DryMigration for composite.
+func (c composite) ApplyDry(tx *sql.Tx) error {
+	return c.apply(context.Background(), tx, true)
+}
+
+// RollbackDry implements DryMigration for composite.
+func (c composite) RollbackDry(tx *sql.Tx) error {
+	return c.rollback(context.Background(), tx, true)
+}
+
+// Irreversible implements IrreversibleMigration for composite.
+func (c composite) Irreversible() bool {
+	for _, m := range c.subs {
+		if isIrreversible(m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c composite) apply(ctx context.Context, tx *sql.Tx, isDry bool) error {
+	if c.err != nil {
+		return c.err
+	}
+	for i, m := range c.subs {
+		if err := applyMigration(ctx, tx, m, isDry); err != nil {
+			return fmt.Errorf("sub-migration %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (c composite) rollback(ctx context.Context, tx *sql.Tx, isDry bool) error {
+	if c.err != nil {
+		return c.err
+	}
+	for i := len(c.subs) - 1; i >= 0; i-- {
+		if err := rollbackMigration(ctx, tx, c.subs[i], isDry); err != nil {
+			return fmt.Errorf("sub-migration %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+var _ ContextMigration = composite{}
+var _ DryMigration = composite{}
+var _ IrreversibleMigration = composite{}
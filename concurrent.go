@@ -0,0 +1,103 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+)
+
+// ConcurrentIndex returns a NonTransactional migration named name building a
+// PostgreSQL index without locking out writes. createSQL should be a CREATE
+// INDEX CONCURRENTLY statement and dropSQL the matching DROP INDEX
+// CONCURRENTLY IF EXISTS one. If createSQL fails after creating the index, it
+// leaves an invalid index behind, so dropSQL is run to remove it before the
+// error is returned, and the migration can simply be retried. Only an index
+// that pg_index reports invalid is dropped: a valid one, e.g. one createSQL
+// failed on because of its name, is left alone, and so is any index if
+// createSQL can't be parsed for its name. Rollback runs dropSQL.
+func ConcurrentIndex(name, createSQL, dropSQL string) Migration {
+	return concurrentIndex{name: name, createSQL: createSQL, dropSQL: dropSQL}
+}
+
+// concurrentIndex is a Migration returned by ConcurrentIndex.
+type concurrentIndex struct {
+	name      string
+	createSQL string
+	dropSQL   string
+}
+
+// Apply implements Migration for concurrentIndex. The index can't be built in
+// a transaction, so it returns ErrNonTransactional.
+func (m concurrentIndex) Apply(tx *sql.Tx) error {
+	return ErrNonTransactional{Name: m.name}
+}
+
+// Rollback implements Migration for concurrentIndex. The index can't be
+// dropped in a transaction, so it returns ErrNonTransactional.
+func (m concurrentIndex) Rollback(tx *sql.Tx) error {
+	return ErrNonTransactional{Name: m.name}
+}
+
+// Name implements Migration for concurrentIndex.
+func (m concurrentIndex) Name() string {
+	return m.name
+}
+
+// ApplyNoTx implements NonTransactional for concurrentIndex.
+func (m concurrentIndex) ApplyNoTx(ctx context.Context, db DB) error {
+	_, err := db.ExecContext(ctx, m.createSQL)
+	if err == nil {
+		return nil
+	}
+
+	index, ok := indexName(m.createSQL)
+	if !ok {
+		return err
+	}
+
+	// The context may be what failed the statement, so the cleanup doesn't
+	// use it.
+	var invalid bool
+	checkErr := db.QueryRowContext(context.Background(),
+		`SELECT NOT indisvalid FROM pg_index WHERE indexrelid = to_regclass($1)`, index).Scan(&invalid)
+	if checkErr == sql.ErrNoRows || (checkErr == nil && !invalid) {
+		return err
+	}
+	if checkErr != nil {
+		return ErrorPair{Err1: err, Err2: checkErr}
+	}
+
+	_, dropErr := db.ExecContext(context.Background(), m.dropSQL)
+	if dropErr != nil {
+		return ErrorPair{Err1: err, Err2: dropErr}
+	}
+	return err
+}
+
+// createIndexRE matches the start of a CREATE INDEX statement up to the
+// optional schema of the table, which is the schema of the index too.
+var createIndexRE = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:UNIQUE\s+)?INDEX\s+CONCURRENTLY\s+` +
+	`(?:IF\s+NOT\s+EXISTS\s+)?("(?:[^"]|"")+"|\w+)\s+ON\s+(?:ONLY\s+)?(?:("(?:[^"]|"")+"|\w+)\s*\.)?`)
+
+// indexName returns the name of the index created by createSQL, qualified by
+// the schema of its table if it is, as to_regclass accepts it. It returns
+// false if createSQL is not a CREATE INDEX CONCURRENTLY statement naming the
+// index.
+func indexName(createSQL string) (string, bool) {
+	m := createIndexRE.FindStringSubmatch(createSQL)
+	if m == nil {
+		return "", false
+	}
+	if m[2] != "" {
+		return m[2] + "." + m[1], true
+	}
+	return m[1], true
+}
+
+// RollbackNoTx implements NonTransactional for concurrentIndex.
+func (m concurrentIndex) RollbackNoTx(ctx context.Context, db DB) error {
+	_, err := db.ExecContext(ctx, m.dropSQL)
+	return err
+}
+
+var _ NonTransactional = concurrentIndex{}
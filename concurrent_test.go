@@ -0,0 +1,46 @@
+package migration
+
+import "testing"
+
+func TestIndexName(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		createSQL string
+		want      string
+		wantOK    bool
+	}{
+		{
+			name:      "plain",
+			createSQL: "CREATE INDEX CONCURRENTLY users_email_idx ON users (email)",
+			want:      "users_email_idx",
+			wantOK:    true,
+		},
+		{
+			name:      "schema",
+			createSQL: "create unique index concurrently if not exists users_email_idx on only app.users (email)",
+			want:      "app.users_email_idx",
+			wantOK:    true,
+		},
+		{
+			name:      "quoted",
+			createSQL: "\n\tCREATE INDEX CONCURRENTLY \"Users \"\"idx\" ON \"App\".\"Users\" (email)",
+			want:      `"App"."Users ""idx"`,
+			wantOK:    true,
+		},
+		{
+			name:      "unnamed",
+			createSQL: "CREATE INDEX CONCURRENTLY ON users (email)",
+		},
+		{
+			name:      "not concurrent",
+			createSQL: "CREATE INDEX users_email_idx ON users (email)",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := indexName(tt.createSQL)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got %q, %t, want %q, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
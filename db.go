@@ -0,0 +1,19 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DB is the subset of *sql.DB methods Schema uses. It can be implemented by
+// wrappers adding e.g. query logging or by fakes in tests. Conn is only used
+// by Lock.
+type DB interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+var _ DB = (*sql.DB)(nil)
@@ -0,0 +1,148 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dependent is a Migration that must be applied after the migrations named by
+// DependsOn. SortMigrations, and so Apply, puts every migration after its
+// dependencies and otherwise keeps the order by Order and name. Dependencies
+// missing from the migrations being sorted are ignored, since they are
+// usually applied already. Rollbacks run in the reverse order.
+type Dependent interface {
+	Migration
+
+	DependsOn() []string
+}
+
+// ErrDependencyCycle is returned when migrations depend on each other in a
+// cycle. Names lists the cycle starting and ending with the same name.
+type ErrDependencyCycle struct {
+	Names []string
+}
+
+// Error implements the error interface for ErrDependencyCycle.
+func (err ErrDependencyCycle) Error() string {
+	return fmt.Sprintf("migration dependency cycle: %s", strings.Join(err.Names, " -> "))
+}
+
+var _ error = ErrDependencyCycle{}
+
+// dependsOn returns the dependencies of m or nil if m isn't Dependent.
+func dependsOn(m Migration) []string {
+	if d, ok := m.(Dependent); ok {
+		return d.DependsOn()
+	}
+	return nil
+}
+
+// hasDependencies reports whether some of migrations have dependencies.
+func hasDependencies(migrations []Migration) bool {
+	for _, m := range migrations {
+		if len(dependsOn(m)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sortDependencies reorders sorted, which is sorted by order and name, so that
+// every migration comes after its dependencies, picking the earliest ready
+// migration each time. Migrations in a cycle are left in the original order;
+// checkDependencies reports them.
+func sortDependencies(sorted []Migration) []Migration {
+	index := make(map[string]int, len(sorted))
+	for i, m := range sorted {
+		if _, ok := index[m.Name()]; !ok {
+			index[m.Name()] = i
+		}
+	}
+
+	res := make([]Migration, 0, len(sorted))
+	done := make([]bool, len(sorted))
+	ready := func(m Migration) bool {
+		for _, dep := range dependsOn(m) {
+			if i, ok := index[dep]; ok && !done[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for len(res) < len(sorted) {
+		next := -1
+		for i, m := range sorted {
+			if !done[i] && ready(m) {
+				next = i
+				break
+			}
+		}
+
+		if next < 0 {
+			// A cycle: keep the rest as is.
+			for i, m := range sorted {
+				if !done[i] {
+					res = append(res, m)
+				}
+			}
+			break
+		}
+
+		done[next] = true
+		res = append(res, sorted[next])
+	}
+
+	return res
+}
+
+// checkDependencies returns ErrDependencyCycle if migrations, indexed in
+// byName, have a dependency cycle.
+func checkDependencies(migrations []Migration, byName map[string]Migration) error {
+	if !hasDependencies(migrations) {
+		return nil
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(migrations))
+	var path []string
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i, n := range path {
+				if n == name {
+					return append(append([]string(nil), path[i:]...), name)
+				}
+			}
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range dependsOn(byName[name]) {
+			if byName[dep] == nil {
+				continue
+			}
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, m := range SortMigrations(migrations) {
+		if cycle := visit(m.Name()); cycle != nil {
+			return ErrDependencyCycle{Names: cycle}
+		}
+	}
+	return nil
+}
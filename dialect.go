@@ -0,0 +1,222 @@
+package migration
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ColumnType is a type of a migrations table column.
+type ColumnType int
+
+// Column types.
+const (
+	// TypeName is the type of the unique migration name column.
+	TypeName ColumnType = iota
+	// TypeTime is a timestamp type.
+	TypeTime
+	// TypeText is a nullable text type.
+	TypeText
+	// TypeInt is a nullable 64-bit integer type.
+	TypeInt
+	// TypeID is the type of the record sequence number column: a nullable
+	// 64-bit integer that is unique where the database can enforce it.
+	TypeID
+)
+
+// Dialect abstracts the SQL that differs between databases in the statements
+// Schema generates. The SQL of migrations themselves is not affected.
+type Dialect interface {
+	// QuoteIdent quotes an identifier.
+	QuoteIdent(ident string) string
+	// Placeholder returns the placeholder of the n-th query argument,
+	// counting from 1.
+	Placeholder(n int) string
+	// Table returns the quoted name of a table in a schema.
+	Table(schema, table string) string
+	// CreateSchema returns the statement creating a schema if it doesn't
+	// exist, or an empty string if the database has no schemas.
+	CreateSchema(schema string) string
+	// ColumnType returns the SQL type of t.
+	ColumnType(t ColumnType) string
+	// TableExists returns the query and its arguments reporting whether a
+	// table exists as a single boolean row.
+	TableExists(schema, table string) (string, []interface{})
+}
+
+// TxLocker is implemented by dialects supporting locks released at the end of
+// the transaction. The lock makes concurrent Apply and Rollback transactions
+// on the same migrations table wait for each other.
+type TxLocker interface {
+	// TxLock returns the statement acquiring the lock, taking its key as the
+	// only argument.
+	TxLock() string
+}
+
+// SearchPather is implemented by dialects that can set the schema unqualified
+// names refer to for the rest of a transaction.
+type SearchPather interface {
+	// SetSearchPath returns the statement setting the search path to schema.
+	SetSearchPath(schema string) string
+}
+
+// PostgresDialect is the PostgreSQL dialect. It's the default one.
+type PostgresDialect struct{}
+
+// QuoteIdent implements Dialect for PostgresDialect.
+func (PostgresDialect) QuoteIdent(ident string) string {
+	return quoteIdent(ident, `"`)
+}
+
+// Placeholder implements Dialect for PostgresDialect.
+func (PostgresDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// Table implements Dialect for PostgresDialect.
+func (d PostgresDialect) Table(schema, table string) string {
+	return d.QuoteIdent(schema) + "." + d.QuoteIdent(table)
+}
+
+// CreateSchema implements Dialect for PostgresDialect.
+func (d PostgresDialect) CreateSchema(schema string) string {
+	return `CREATE SCHEMA IF NOT EXISTS ` + d.QuoteIdent(schema)
+}
+
+// ColumnType implements Dialect for PostgresDialect.
+func (PostgresDialect) ColumnType(t ColumnType) string {
+	switch t {
+	case TypeName:
+		return "TEXT UNIQUE"
+	case TypeTime:
+		return "TIMESTAMP"
+	case TypeInt:
+		return "BIGINT"
+	case TypeID:
+		return "BIGINT UNIQUE"
+	default:
+		return "TEXT"
+	}
+}
+
+// TableExists implements Dialect for PostgresDialect.
+func (PostgresDialect) TableExists(schema, table string) (string, []interface{}) {
+	return `SELECT EXISTS (SELECT 1 FROM information_schema.tables ` +
+		`WHERE table_schema = $1 AND table_name = $2)`, []interface{}{schema, table}
+}
+
+// TxLock implements TxLocker for PostgresDialect.
+func (PostgresDialect) TxLock() string {
+	return `SELECT pg_advisory_xact_lock($1)`
+}
+
+// SetSearchPath implements SearchPather for PostgresDialect.
+func (d PostgresDialect) SetSearchPath(schema string) string {
+	return `SET LOCAL search_path TO ` + d.QuoteIdent(schema)
+}
+
+var (
+	_ Dialect      = PostgresDialect{}
+	_ TxLocker     = PostgresDialect{}
+	_ SearchPather = PostgresDialect{}
+)
+
+// MySQLDialect is the MySQL dialect. MySQL schemas are databases.
+type MySQLDialect struct{}
+
+// QuoteIdent implements Dialect for MySQLDialect.
+func (MySQLDialect) QuoteIdent(ident string) string {
+	return quoteIdent(ident, "`")
+}
+
+// Placeholder implements Dialect for MySQLDialect.
+func (MySQLDialect) Placeholder(n int) string {
+	return "?"
+}
+
+// Table implements Dialect for MySQLDialect.
+func (d MySQLDialect) Table(schema, table string) string {
+	return d.QuoteIdent(schema) + "." + d.QuoteIdent(table)
+}
+
+// CreateSchema implements Dialect for MySQLDialect.
+func (d MySQLDialect) CreateSchema(schema string) string {
+	return `CREATE SCHEMA IF NOT EXISTS ` + d.QuoteIdent(schema)
+}
+
+// ColumnType implements Dialect for MySQLDialect.
+func (MySQLDialect) ColumnType(t ColumnType) string {
+	switch t {
+	case TypeName:
+		return "VARCHAR(255) UNIQUE"
+	case TypeTime:
+		return "DATETIME(6)"
+	case TypeInt:
+		return "BIGINT"
+	case TypeID:
+		return "BIGINT UNIQUE"
+	default:
+		return "TEXT"
+	}
+}
+
+// TableExists implements Dialect for MySQLDialect.
+func (MySQLDialect) TableExists(schema, table string) (string, []interface{}) {
+	return `SELECT EXISTS (SELECT 1 FROM information_schema.tables ` +
+		`WHERE table_schema = ? AND table_name = ?)`, []interface{}{schema, table}
+}
+
+var _ Dialect = MySQLDialect{}
+
+// SQLiteDialect is the SQLite dialect. SQLite has no schemas, so the schema
+// name is ignored.
+type SQLiteDialect struct{}
+
+// QuoteIdent implements Dialect for SQLiteDialect.
+func (SQLiteDialect) QuoteIdent(ident string) string {
+	return quoteIdent(ident, `"`)
+}
+
+// Placeholder implements Dialect for SQLiteDialect.
+func (SQLiteDialect) Placeholder(n int) string {
+	return "?"
+}
+
+// Table implements Dialect for SQLiteDialect.
+func (d SQLiteDialect) Table(schema, table string) string {
+	return d.QuoteIdent(table)
+}
+
+// CreateSchema implements Dialect for SQLiteDialect.
+func (SQLiteDialect) CreateSchema(schema string) string {
+	return ""
+}
+
+// ColumnType implements Dialect for SQLiteDialect.
+func (SQLiteDialect) ColumnType(t ColumnType) string {
+	switch t {
+	case TypeName:
+		return "TEXT UNIQUE"
+	case TypeTime:
+		return "TIMESTAMP"
+	case TypeInt, TypeID:
+		// SQLite can't add a UNIQUE column to an existing table. Its
+		// transactions are serializable, so concurrent records can't be
+		// numbered alike anyway.
+		return "BIGINT"
+	default:
+		return "TEXT"
+	}
+}
+
+// TableExists implements Dialect for SQLiteDialect.
+func (SQLiteDialect) TableExists(schema, table string) (string, []interface{}) {
+	return `SELECT EXISTS (SELECT 1 FROM sqlite_master ` +
+		`WHERE type = 'table' AND name = ?)`, []interface{}{table}
+}
+
+var _ Dialect = SQLiteDialect{}
+
+// quoteIdent quotes ident with q doubling the q characters in it.
+func quoteIdent(ident, q string) string {
+	return q + strings.ReplaceAll(ident, q, q+q) + q
+}
@@ -0,0 +1,89 @@
+package migration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDialects(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		d               Dialect
+		wantQuoted      string
+		wantPlaceholder string
+		wantTable       string
+		wantSchema      string
+	}{
+		{
+			name:            "postgres",
+			d:               PostgresDialect{},
+			wantQuoted:      `"a""b"`,
+			wantPlaceholder: "$2",
+			wantTable:       `"s"."t"`,
+			wantSchema:      `CREATE SCHEMA IF NOT EXISTS "s"`,
+		},
+		{
+			name:            "mysql",
+			d:               MySQLDialect{},
+			wantQuoted:      "`a\"b`",
+			wantPlaceholder: "?",
+			wantTable:       "`s`.`t`",
+			wantSchema:      "CREATE SCHEMA IF NOT EXISTS `s`",
+		},
+		{
+			name:            "sqlite",
+			d:               SQLiteDialect{},
+			wantQuoted:      `"a""b"`,
+			wantPlaceholder: "?",
+			wantTable:       `"t"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.d.QuoteIdent(`a"b`); got != tt.wantQuoted {
+				t.Errorf("QuoteIdent: got %s, want %s", got, tt.wantQuoted)
+			}
+			if got := tt.d.Placeholder(2); got != tt.wantPlaceholder {
+				t.Errorf("Placeholder: got %s, want %s", got, tt.wantPlaceholder)
+			}
+			if got := tt.d.Table("s", "t"); got != tt.wantTable {
+				t.Errorf("Table: got %s, want %s", got, tt.wantTable)
+			}
+			if got := tt.d.CreateSchema("s"); got != tt.wantSchema {
+				t.Errorf("CreateSchema: got %q, want %q", got, tt.wantSchema)
+			}
+		})
+	}
+}
+
+func TestSQLiteApply(t *testing.T) {
+	db, fdb := newFakeDB(t)
+	sch := NewSchema(db, DefaultSchemaName, DefaultMigrationTableName)
+	sch.SetDialect(SQLiteDialect{})
+
+	if err := sch.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if q := fdb.executed("CREATE SCHEMA"); len(q) > 0 {
+		t.Errorf("Init created a schema: %q", q)
+	}
+
+	n, err := sch.Apply(testMigrations("1", "2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("applied %d migrations, want 2", n)
+	}
+
+	want := []string{"1", "2"}
+	if got := fdb.names(DefaultMigrationTableName); !reflect.DeepEqual(got, want) {
+		t.Errorf("recorded %q, want %q", got, want)
+	}
+
+	for _, q := range fdb.executed("INSERT") {
+		if strings.Contains(q, "$") || !strings.Contains(q, `"`+DefaultMigrationTableName+`"`) {
+			t.Errorf("query not in the SQLite dialect: %s", q)
+		}
+	}
+}
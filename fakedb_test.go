@@ -0,0 +1,850 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDB is an in-memory database understanding the statements Schema runs on
+// the migrations table. Other statements, such as those of migrations, are
+// only logged, except for CREATE TABLE, which creates an empty table. DDL
+// statements report driver.ResultNoRows, as drivers are told to.
+// Transactions see the committed data and their own changes, like READ
+// COMMITTED, and advisory locks block like in PostgreSQL.
+type fakeDB struct {
+	mu       sync.Mutex
+	tables   fakeTables
+	log      []string
+	locks    map[int64]*fakeLock
+	released chan struct{} // closed and replaced whenever a lock is released
+
+	// hook is called with every statement before it runs. A returned error
+	// fails the statement.
+	hook func(query string) error
+	// delay is slept before every statement, emulating a round trip.
+	delay time.Duration
+}
+
+type fakeTables map[string]*fakeTable
+
+type fakeTable struct {
+	cols   []string
+	unique map[string]bool
+	rows   []fakeRow
+}
+
+type fakeRow map[string]driver.Value
+
+type fakeLock struct {
+	owner *fakeConn
+	n     int
+}
+
+// fakeError is an error with a SQLSTATE code like those of lib/pq and pgx.
+type fakeError struct {
+	state string
+	msg   string
+}
+
+func (err fakeError) Error() string    { return err.msg }
+func (err fakeError) SQLState() string { return err.state }
+
+// newFakeDB returns a new fakeDB and a *sql.DB using it.
+func newFakeDB(t testing.TB) (*sql.DB, *fakeDB) {
+	fdb := &fakeDB{
+		tables:   fakeTables{},
+		locks:    map[int64]*fakeLock{},
+		released: make(chan struct{}),
+	}
+	db := sql.OpenDB(fakeConnector{db: fdb})
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db, fdb
+}
+
+// setHook sets the hook called with every statement.
+func (db *fakeDB) setHook(hook func(query string) error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.hook = hook
+}
+
+// executed returns the statements run so far starting with prefix, in order,
+// including those of rolled back transactions.
+func (db *fakeDB) executed(prefix string) []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var res []string
+	for _, q := range db.log {
+		if strings.HasPrefix(q, prefix) {
+			res = append(res, q)
+		}
+	}
+	return res
+}
+
+// column returns the committed values of col in table, in insertion order.
+func (db *fakeDB) column(table, col string) []driver.Value {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tables[table]
+	if t == nil {
+		return nil
+	}
+
+	var res []driver.Value
+	for _, row := range t.rows {
+		res = append(res, row[col])
+	}
+	return res
+}
+
+// names returns the committed names in table, in insertion order.
+func (db *fakeDB) names(table string) []string {
+	var res []string
+	for _, v := range db.column(table, "name") {
+		res = append(res, fmt.Sprint(v))
+	}
+	return res
+}
+
+// insertRaw adds row to table bypassing its constraints, e.g. to corrupt it.
+func (db *fakeDB) insertRaw(table string, row fakeRow) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tables[table]
+	t.rows = append(t.rows, row)
+}
+
+type fakeConnector struct {
+	db *fakeDB
+}
+
+func (c fakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{db: c.db}, nil
+}
+
+func (c fakeConnector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return nil, fmt.Errorf("fakedb: use a connector")
+}
+
+// fakeConn is a connection to a fakeDB.
+type fakeConn struct {
+	db        *fakeDB
+	tx        *fakeTx
+	xactLocks []int64
+}
+
+// fakeTx is a transaction of a fakeConn. Its changes are kept as operations
+// applied to the committed tables on commit.
+type fakeTx struct {
+	c          *fakeConn
+	ops        []fakeOp
+	savepoints map[string]int
+}
+
+// fakeOp is a change of the tables.
+type fakeOp func(ts fakeTables) error
+
+var (
+	_ driver.Conn                    = (*fakeConn)(nil)
+	_ driver.ConnBeginTx             = (*fakeConn)(nil)
+	_ driver.ExecerContext           = (*fakeConn)(nil)
+	_ driver.QueryerContext          = (*fakeConn)(nil)
+	_ driver.Tx                      = (*fakeTx)(nil)
+	_ driver.Connector               = fakeConnector{}
+	_ driver.Rows                    = (*fakeRows)(nil)
+	_ driver.StmtExecContext         = (*fakeStmt)(nil)
+	_ driver.StmtQueryContext        = (*fakeStmt)(nil)
+	_ driver.NamedValueChecker       = (*fakeConn)(nil)
+	_ driver.SessionResetter         = (*fakeConn)(nil)
+	_ driver.Validator               = (*fakeConn)(nil)
+	_ interface{ SQLState() string } = fakeError{}
+)
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	for key, l := range c.db.locks {
+		if l.owner == c {
+			l.n = 1
+			c.db.release(c, key)
+		}
+	}
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.tx = &fakeTx{c: c, savepoints: map[string]int{}}
+	return c.tx, nil
+}
+
+func (c *fakeConn) CheckNamedValue(v *driver.NamedValue) error {
+	var err error
+	v.Value, err = driver.DefaultParameterConverter.ConvertValue(v.Value)
+	return err
+}
+
+func (c *fakeConn) ResetSession(ctx context.Context) error { return nil }
+func (c *fakeConn) IsValid() bool                          { return true }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := c.run(ctx, query, values(args))
+	if err != nil {
+		return nil, err
+	}
+	if ddlRE.MatchString(query) {
+		return driver.ResultNoRows, nil
+	}
+	return driver.RowsAffected(res.affected), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res, err := c.run(ctx, query, values(args))
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{cols: res.cols, rows: res.rows}, nil
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	res := make([]driver.Value, len(args))
+	for i, a := range args {
+		res[i] = a.Value
+	}
+	return res
+}
+
+func (tx *fakeTx) Commit() error {
+	c := tx.c
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.tx = nil
+	c.releaseXact()
+
+	ts := c.db.tables.clone()
+	for _, op := range tx.ops {
+		if err := op(ts); err != nil {
+			return err
+		}
+	}
+	c.db.tables = ts
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	c := tx.c
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.tx = nil
+	c.releaseXact()
+	return nil
+}
+
+// releaseXact releases the transaction-level locks of c.
+func (c *fakeConn) releaseXact() {
+	for _, key := range c.xactLocks {
+		c.db.release(c, key)
+	}
+	c.xactLocks = nil
+}
+
+// release releases a lock of c on key, reporting whether c held it.
+func (db *fakeDB) release(c *fakeConn, key int64) bool {
+	l := db.locks[key]
+	if l == nil || l.owner != c {
+		return false
+	}
+
+	l.n--
+	if l.n == 0 {
+		delete(db.locks, key)
+		close(db.released)
+		db.released = make(chan struct{})
+	}
+	return true
+}
+
+// lock acquires the lock on key for c, blocking while another connection
+// holds it.
+func (c *fakeConn) lock(ctx context.Context, key int64, xact bool) error {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for {
+		l := db.locks[key]
+		if l == nil {
+			db.locks[key] = &fakeLock{owner: c, n: 1}
+			break
+		}
+		if l.owner == c {
+			l.n++
+			break
+		}
+
+		ch := db.released
+		db.mu.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			db.mu.Lock()
+			return ctx.Err()
+		}
+		db.mu.Lock()
+	}
+
+	if xact {
+		c.xactLocks = append(c.xactLocks, key)
+	}
+	return nil
+}
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), named(args))
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	res := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		res[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return res
+}
+
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.c.ExecContext(ctx, s.query, args)
+}
+
+func (s *fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.c.QueryContext(ctx, s.query, args)
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// fakeResult is the result of a statement.
+type fakeResult struct {
+	cols     []string
+	rows     [][]driver.Value
+	affected int64
+}
+
+var (
+	placeholderRE = regexp.MustCompile(`\$[0-9]+`)
+	lockRE        = regexp.MustCompile(`^SELECT pg_advisory_(xact_lock|lock|unlock)\(\?\)$`)
+	createRE      = regexp.MustCompile(`^CREATE TABLE (?:IF NOT EXISTS )?(\S+) \((.*)\)$`)
+	addColumnRE   = regexp.MustCompile(`^ALTER TABLE (\S+) ADD COLUMN (\S+) (.*)$`)
+	existsRE      = regexp.MustCompile(`^SELECT EXISTS \(SELECT 1 FROM (?:information_schema\.tables|sqlite_master) `)
+	insertRE      = regexp.MustCompile(`^INSERT INTO (\S+) \(([^)]*)\) VALUES `)
+	deleteRE      = regexp.MustCompile(`^DELETE FROM (\S+) WHERE (.*)$`)
+	selectRE      = regexp.MustCompile(`^SELECT (.+?) FROM (\S+)(?: (.*))?$`)
+	savepointRE   = regexp.MustCompile(`^(SAVEPOINT|RELEASE SAVEPOINT|ROLLBACK TO SAVEPOINT) (\w+)$`)
+	ddlRE         = regexp.MustCompile(`(?i)^\s*(CREATE|ALTER|DROP) `)
+)
+
+// run runs query on c.
+func (c *fakeConn) run(ctx context.Context, query string, args []driver.Value) (*fakeResult, error) {
+	db := c.db
+	if db.delay > 0 {
+		time.Sleep(db.delay)
+	}
+
+	db.mu.Lock()
+	db.log = append(db.log, query)
+	hook := db.hook
+	db.mu.Unlock()
+
+	if hook != nil {
+		if err := hook(query); err != nil {
+			return nil, err
+		}
+	}
+
+	q := strings.Join(strings.Fields(query), " ")
+	q = strings.NewReplacer(`"`, ``, "`", ``).Replace(q)
+	q = placeholderRE.ReplaceAllString(q, "?")
+
+	if m := lockRE.FindStringSubmatch(q); m != nil {
+		key := args[0].(int64)
+		if m[1] != "unlock" {
+			err := c.lock(ctx, key, m[1] == "xact_lock")
+			return &fakeResult{cols: []string{"lock"}, rows: [][]driver.Value{{nil}}}, err
+		}
+
+		db.mu.Lock()
+		ok := db.release(c, key)
+		db.mu.Unlock()
+		return &fakeResult{cols: []string{"unlock"}, rows: [][]driver.Value{{ok}}}, nil
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return c.exec(q, args)
+}
+
+// view returns the tables as seen by c.
+func (c *fakeConn) view() fakeTables {
+	ts := c.db.tables.clone()
+	if c.tx != nil {
+		for _, op := range c.tx.ops {
+			op(ts)
+		}
+	}
+	return ts
+}
+
+// change applies op to the tables as seen by c, keeping it in the
+// transaction if there is one and committing it otherwise.
+func (c *fakeConn) change(op fakeOp) error {
+	if err := op(c.view()); err != nil {
+		return err
+	}
+	if c.tx != nil {
+		c.tx.ops = append(c.tx.ops, op)
+		return nil
+	}
+	return op(c.db.tables)
+}
+
+// exec runs the normalized query q with db.mu held.
+func (c *fakeConn) exec(q string, args []driver.Value) (*fakeResult, error) {
+	ts := c.view()
+	res := &fakeResult{}
+
+	if m := savepointRE.FindStringSubmatch(q); m != nil && c.tx != nil {
+		switch m[1] {
+		case "SAVEPOINT":
+			c.tx.savepoints[m[2]] = len(c.tx.ops)
+		case "ROLLBACK TO SAVEPOINT":
+			c.tx.ops = c.tx.ops[:c.tx.savepoints[m[2]]]
+		}
+		return res, nil
+	}
+
+	if m := createRE.FindStringSubmatch(q); m != nil {
+		name, defs := m[1], strings.Split(m[2], ", ")
+		return res, c.change(func(ts fakeTables) error {
+			if ts[name] != nil {
+				return nil
+			}
+
+			t := &fakeTable{unique: map[string]bool{}}
+			for _, def := range defs {
+				col := strings.Fields(def)[0]
+				t.cols = append(t.cols, col)
+				t.unique[col] = strings.Contains(def, "UNIQUE")
+			}
+			ts[name] = t
+			return nil
+		})
+	}
+
+	if m := addColumnRE.FindStringSubmatch(q); m != nil && ts[m[1]] != nil {
+		name, col, unique := m[1], m[2], strings.Contains(m[3], "UNIQUE")
+		return res, c.change(func(ts fakeTables) error {
+			t := ts[name]
+			for _, c := range t.cols {
+				if c == col {
+					return fakeError{state: "42701", msg: "column already exists: " + col}
+				}
+			}
+			t.cols = append(t.cols, col)
+			t.unique[col] = unique
+			return nil
+		})
+	}
+
+	if existsRE.MatchString(q) {
+		var parts []string
+		for _, a := range args {
+			parts = append(parts, fmt.Sprint(a))
+		}
+		res.cols = []string{"exists"}
+		res.rows = [][]driver.Value{{ts[strings.Join(parts, ".")] != nil}}
+		return res, nil
+	}
+
+	if m := insertRE.FindStringSubmatch(q); m != nil && ts[m[1]] != nil {
+		name, cols := m[1], strings.Split(m[2], ", ")
+		for len(args) > 0 {
+			row := fakeRow{}
+			for i, col := range cols {
+				row[col] = args[i]
+			}
+			args = args[len(cols):]
+
+			err := c.change(func(ts fakeTables) error {
+				return ts[name].insert(row)
+			})
+			if err != nil {
+				return nil, err
+			}
+			res.affected++
+		}
+		return res, nil
+	}
+
+	if m := deleteRE.FindStringSubmatch(q); m != nil && ts[m[1]] != nil {
+		name := m[1]
+		pred, _, err := parseWhere(m[2], args)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range ts[name].rows {
+			if pred(row) {
+				res.affected++
+			}
+		}
+		return res, c.change(func(ts fakeTables) error {
+			t := ts[name]
+			var rows []fakeRow
+			for _, row := range t.rows {
+				if !pred(row) {
+					rows = append(rows, row)
+				}
+			}
+			t.rows = rows
+			return nil
+		})
+	}
+
+	if m := selectRE.FindStringSubmatch(q); m != nil {
+		t := ts[m[2]]
+		if t == nil {
+			return nil, fakeError{state: "42P01", msg: "relation does not exist: " + m[2]}
+		}
+		return t.query(m[1], m[3], args)
+	}
+
+	return res, nil
+}
+
+func (ts fakeTables) clone() fakeTables {
+	res := make(fakeTables, len(ts))
+	for name, t := range ts {
+		unique := make(map[string]bool, len(t.unique))
+		for col, u := range t.unique {
+			unique[col] = u
+		}
+		res[name] = &fakeTable{
+			cols:   append([]string(nil), t.cols...),
+			unique: unique,
+			rows:   append([]fakeRow(nil), t.rows...),
+		}
+	}
+	return res
+}
+
+// insert inserts row checking the unique columns.
+func (t *fakeTable) insert(row fakeRow) error {
+	for col, v := range row {
+		if !t.hasColumn(col) {
+			return fakeError{state: "42703", msg: "column does not exist: " + col}
+		}
+		if !t.unique[col] || v == nil {
+			continue
+		}
+		for _, r := range t.rows {
+			if compareValues(r[col], v) == 0 {
+				return fakeError{state: "23505", msg: fmt.Sprintf("duplicate key %s = %v", col, v)}
+			}
+		}
+	}
+	t.rows = append(t.rows, row)
+	return nil
+}
+
+func (t *fakeTable) hasColumn(col string) bool {
+	for _, c := range t.cols {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	groupRE = regexp.MustCompile(`^GROUP BY (\w+) HAVING COUNT\(\*\) > 1(?: (.*))?$`)
+	orderRE = regexp.MustCompile(`^ORDER BY (.*?)(?: LIMIT \?)?$`)
+	caseRE  = regexp.MustCompile(`^CASE WHEN (\w+) IS NULL THEN 0 ELSE 1 END( DESC)?$`)
+	itemRE  = regexp.MustCompile(`^(\w+)( DESC)?$`)
+)
+
+// query runs a SELECT of what from t, the rest of which is tail.
+func (t *fakeTable) query(what, tail string, args []driver.Value) (*fakeResult, error) {
+	rows := t.rows
+	if strings.HasPrefix(tail, "WHERE ") {
+		where := tail[len("WHERE "):]
+		end := len(where)
+		for _, kw := range []string{" GROUP BY ", " ORDER BY ", " LIMIT "} {
+			if i := strings.Index(where, kw); i >= 0 && i < end {
+				end = i
+			}
+		}
+		tail = strings.TrimSpace(where[end:])
+
+		pred, n, err := parseWhere(where[:end], args)
+		if err != nil {
+			return nil, err
+		}
+		args = args[n:]
+
+		rows = nil
+		for _, row := range t.rows {
+			if pred(row) {
+				rows = append(rows, row)
+			}
+		}
+	}
+
+	if m := groupRE.FindStringSubmatch(tail); m != nil {
+		count := map[interface{}]int{}
+		var groups []fakeRow
+		for _, row := range rows {
+			k := row[m[1]]
+			if count[k]++; count[k] == 2 {
+				groups = append(groups, fakeRow{m[1]: k})
+			}
+		}
+		rows, tail = groups, m[2]
+	}
+
+	if m := orderRE.FindStringSubmatch(tail); m != nil {
+		rows = append([]fakeRow(nil), rows...)
+		items := strings.Split(m[1], ", ")
+		var err error
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, item := range items {
+				c, e := compareBy(item, rows[i], rows[j])
+				if e != nil {
+					err = e
+				}
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else if tail != "" && tail != "LIMIT ?" {
+		return nil, fmt.Errorf("fakedb: unsupported clause %q", tail)
+	}
+
+	if strings.HasSuffix(tail, "LIMIT ?") {
+		if n := int(args[0].(int64)); n < len(rows) {
+			rows = rows[:n]
+		}
+	}
+
+	res := &fakeResult{}
+	switch what {
+	case "COUNT(*)":
+		res.cols = []string{"count"}
+		res.rows = [][]driver.Value{{int64(len(rows))}}
+		return res, nil
+	case "COALESCE(MAX(id), 0)":
+		var max int64
+		for _, row := range rows {
+			if id, ok := row["id"].(int64); ok && id > max {
+				max = id
+			}
+		}
+		res.cols = []string{"max"}
+		res.rows = [][]driver.Value{{max}}
+		return res, nil
+	case "*":
+		res.cols = t.cols
+	default:
+		res.cols = strings.Split(what, ", ")
+	}
+
+	for _, col := range res.cols {
+		if !t.hasColumn(col) {
+			return nil, fakeError{state: "42703", msg: "column does not exist: " + col}
+		}
+	}
+
+	for _, row := range rows {
+		vals := make([]driver.Value, len(res.cols))
+		for i, col := range res.cols {
+			vals[i] = row[col]
+		}
+		res.rows = append(res.rows, vals)
+	}
+	return res, nil
+}
+
+// compareBy compares a and b by the ORDER BY item.
+func compareBy(item string, a, b fakeRow) (int, error) {
+	var c int
+	var desc bool
+	if m := caseRE.FindStringSubmatch(item); m != nil {
+		c = compareValues(a[m[1]] != nil, b[m[1]] != nil)
+		desc = m[2] != ""
+	} else if m := itemRE.FindStringSubmatch(item); m != nil {
+		c = compareValues(a[m[1]], b[m[1]])
+		desc = m[2] != ""
+	} else {
+		return 0, fmt.Errorf("fakedb: unsupported order %q", item)
+	}
+
+	if desc {
+		c = -c
+	}
+	return c, nil
+}
+
+var termRE = regexp.MustCompile(`^(?:(\w+) (= \?|BETWEEN \? AND \?|IS NULL|IS NOT NULL)|1 = 0)(?: (AND|OR) |$)`)
+
+// parseWhere parses a WHERE condition of comparisons of columns with
+// arguments joined with AND and OR. It returns the predicate and the number
+// of arguments used.
+func parseWhere(cond string, args []driver.Value) (func(fakeRow) bool, int, error) {
+	type term func(fakeRow) bool
+	var disj [][]term
+	var conj []term
+	n := 0
+	for cond != "" {
+		m := termRE.FindStringSubmatch(cond)
+		if m == nil {
+			return nil, 0, fmt.Errorf("fakedb: unsupported condition %q", cond)
+		}
+		cond = cond[len(m[0]):]
+
+		col := m[1]
+		switch m[2] {
+		case "= ?":
+			v := args[n]
+			n++
+			conj = append(conj, func(row fakeRow) bool {
+				return row[col] != nil && compareValues(row[col], v) == 0
+			})
+		case "BETWEEN ? AND ?":
+			from, to := args[n], args[n+1]
+			n += 2
+			conj = append(conj, func(row fakeRow) bool {
+				return row[col] != nil && compareValues(row[col], from) >= 0 && compareValues(row[col], to) <= 0
+			})
+		case "IS NULL":
+			conj = append(conj, func(row fakeRow) bool { return row[col] == nil })
+		case "IS NOT NULL":
+			conj = append(conj, func(row fakeRow) bool { return row[col] != nil })
+		default:
+			conj = append(conj, func(row fakeRow) bool { return false })
+		}
+
+		if m[3] != "AND" {
+			disj = append(disj, conj)
+			conj = nil
+		}
+	}
+
+	return func(row fakeRow) bool {
+		for _, conj := range disj {
+			ok := true
+			for _, t := range conj {
+				ok = ok && t(row)
+			}
+			if ok {
+				return true
+			}
+		}
+		return false
+	}, n, nil
+}
+
+// compareValues compares driver values of the same type, NULLs sorting last.
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	switch a := a.(type) {
+	case int64:
+		b := b.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case bool:
+		switch b := b.(bool); {
+		case a == b:
+			return 0
+		case !a:
+			return -1
+		}
+		return 1
+	}
+	panic(fmt.Sprintf("fakedb: can't compare %T", a))
+}
@@ -0,0 +1,202 @@
+package migration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	upSuffix   = ".up.sql"
+	downSuffix = ".down.sql"
+)
+
+// ErrIncompleteMigration is returned by FromFS when a migration lacks either
+// its up or its down file.
+type ErrIncompleteMigration struct {
+	Name    string
+	Missing string
+}
+
+// Error implements the error interface for ErrIncompleteMigration.
+func (err ErrIncompleteMigration) Error() string {
+	return fmt.Sprintf("migration %q has no %s file", err.Name, err.Missing)
+}
+
+var _ error = ErrIncompleteMigration{}
+
+// FromFS loads migrations from SQL files in dir. Every migration consists of
+// two files, NAME.up.sql and NAME.down.sql, executed on apply and on rollback
+// respectively. Other files are ignored. The migrations are SQLMigration
+// values sorted by name.
+func FromFS(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ups := map[string]string{}
+	downs := map[string]string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		var files map[string]string
+		var name string
+		switch {
+		case strings.HasSuffix(e.Name(), upSuffix):
+			files, name = ups, strings.TrimSuffix(e.Name(), upSuffix)
+		case strings.HasSuffix(e.Name(), downSuffix):
+			files, name = downs, strings.TrimSuffix(e.Name(), downSuffix)
+		default:
+			continue
+		}
+
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = string(b)
+	}
+
+	var res []Migration
+	for name, up := range ups {
+		down, ok := downs[name]
+		if !ok {
+			return nil, ErrIncompleteMigration{Name: name, Missing: "down"}
+		}
+
+		res = append(res, SQLMigration{
+			NameString: name,
+			Up:         up,
+			Down:       down,
+		})
+	}
+
+	for name := range downs {
+		if _, ok := ups[name]; !ok {
+			return nil, ErrIncompleteMigration{Name: name, Missing: "up"}
+		}
+	}
+
+	sort.Sort(migrationsByOrder(res))
+
+	return res, nil
+}
+
+// Files of a migration directory read by FromFSTree.
+const (
+	treeUpFile   = "up.sql"
+	treeDownFile = "down.sql"
+	treeMetaFile = "meta.json"
+)
+
+// ErrInvalidMeta is returned by FromFSTree when the meta.json file of a
+// migration can't be parsed.
+type ErrInvalidMeta struct {
+	Name string
+	Err  error
+}
+
+// Error implements the error interface for ErrInvalidMeta.
+func (err ErrInvalidMeta) Error() string {
+	return fmt.Sprintf("migration %q has invalid %s: %v", err.Name, treeMetaFile, err.Err)
+}
+
+// Unwrap returns the underlying error.
+func (err ErrInvalidMeta) Unwrap() error {
+	return err.Err
+}
+
+var _ error = ErrInvalidMeta{}
+
+// treeMeta is the contents of a meta.json file.
+type treeMeta struct {
+	Tags        []string `json:"tags"`
+	Description string   `json:"description"`
+}
+
+// FromFSTree loads migrations from the subdirectories of root, one migration
+// per directory named after it. A directory holds up.sql, executed on apply,
+// and optionally down.sql, executed on rollback, and meta.json, an object
+// with the "tags" and "description" keys that set TagList and Description.
+// Without down.sql the migration is irreversible. Files in root itself and
+// other files in the directories are ignored. It returns
+// ErrIncompleteMigration for a directory without up.sql and ErrInvalidMeta
+// for a meta.json that doesn't match the format. The migrations are
+// SQLMigration values sorted by name.
+func FromFSTree(fsys fs.FS, root string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Migration
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		m, err := readTreeMigration(fsys, path.Join(root, e.Name()), e.Name())
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+
+	sort.Sort(migrationsByOrder(res))
+
+	return res, nil
+}
+
+// readTreeMigration reads the migration named name from dir.
+func readTreeMigration(fsys fs.FS, dir, name string) (SQLMigration, error) {
+	m := SQLMigration{NameString: name}
+
+	up, err := fs.ReadFile(fsys, path.Join(dir, treeUpFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, ErrIncompleteMigration{Name: name, Missing: "up"}
+	}
+	if err != nil {
+		return m, err
+	}
+	m.Up = string(up)
+
+	down, err := fs.ReadFile(fsys, path.Join(dir, treeDownFile))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		m.IsIrreversible = true
+	case err != nil:
+		return m, err
+	default:
+		m.Down = string(down)
+	}
+
+	b, err := fs.ReadFile(fsys, path.Join(dir, treeMetaFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+
+	var meta treeMeta
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&meta); err != nil {
+		return m, ErrInvalidMeta{Name: name, Err: err}
+	}
+	if dec.More() {
+		return m, ErrInvalidMeta{Name: name, Err: errors.New("unexpected data after the object")}
+	}
+
+	m.TagList = meta.Tags
+	m.Description = meta.Description
+	return m, nil
+}
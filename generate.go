@@ -0,0 +1,55 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// GenerateFiles creates an empty migration in dir for use with FromFS: the
+// files TIMESTAMP_NAME.up.sql and TIMESTAMP_NAME.down.sql, where TIMESTAMP is
+// the current UTC time formatted as required by TimestampPrefixValidator. It
+// returns ErrInvalidName if the resulting name doesn't pass the validator and
+// never overwrites existing files. It returns the paths of the created files.
+func GenerateFiles(dir, name string) (upPath, downPath string, err error) {
+	fullName := time.Now().UTC().Format("20060102150405") + "_" + name
+	if err := TimestampPrefixValidator(fullName); err != nil {
+		return "", "", err
+	}
+
+	upPath = filepath.Join(dir, fullName+upSuffix)
+	downPath = filepath.Join(dir, fullName+downSuffix)
+
+	err = createFile(upPath, "-- "+fullName+": apply\n")
+	if err != nil {
+		return "", "", err
+	}
+
+	err = createFile(downPath, "-- "+fullName+": rollback\n")
+	if err != nil {
+		if rmErr := os.Remove(upPath); rmErr != nil {
+			err = ErrorPair{Err1: err, Err2: rmErr}
+		}
+		return "", "", err
+	}
+
+	return upPath, downPath, nil
+}
+
+// createFile creates a new file with content, failing if it exists.
+func createFile(name, content string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(content)
+	closeErr := f.Close()
+	if err != nil {
+		if closeErr != nil {
+			return ErrorPair{Err1: err, Err2: closeErr}
+		}
+		return err
+	}
+	return closeErr
+}
@@ -0,0 +1,88 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+)
+
+// IgnoredErrorLogger is a Logger that is also told about the errors ignored
+// because of SetIgnoreSQLStates.
+type IgnoredErrorLogger interface {
+	Logger
+
+	IgnoredError(name string, err error)
+}
+
+// ignoreSavepointName is the name of the savepoint ignored errors are rolled
+// back to.
+const ignoreSavepointName = "migration_ignore"
+
+// SetIgnoreSQLStates makes Apply and its variants treat a migration failing
+// with one of the SQLSTATE codes states as applied and record it, e.g. "42P07"
+// (duplicate_table) for a migration creating a table that a hotfix already
+// created. The migration is run in a savepoint and its changes are rolled
+// back to it, so whatever it would have done after the failing statement
+// isn't done. Ignored errors are reported to the logger if it implements
+// IgnoredErrorLogger and to the span as the migration.ignored_sqlstate
+// attribute. Use it only for migrations known to need it; nothing is ignored
+// by default.
+func (sch *Schema) SetIgnoreSQLStates(states ...string) {
+	sch.ignoreStates = states
+}
+
+// ignorable reports whether err has one of the ignored SQLSTATE codes.
+func (sch *Schema) ignorable(err error) bool {
+	state := sqlState(err)
+	if state == "" {
+		return false
+	}
+
+	for _, s := range sch.ignoreStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoring calls f applying m in tx, which is nil for NonTransactional
+// migrations, and ignores its error if it's ignorable.
+func (sch *Schema) ignoring(ctx context.Context, tx *sql.Tx, m Migration, span Span, f func() error) error {
+	if len(sch.ignoreStates) == 0 {
+		return f()
+	}
+
+	if tx != nil {
+		_, err := tx.ExecContext(ctx, `SAVEPOINT `+ignoreSavepointName)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := f()
+	if err != nil && !sch.ignorable(err) {
+		return err
+	}
+
+	if tx != nil {
+		q := `RELEASE SAVEPOINT ` + ignoreSavepointName
+		if err != nil {
+			q = `ROLLBACK TO SAVEPOINT ` + ignoreSavepointName
+		}
+		_, spErr := tx.ExecContext(ctx, q)
+		if spErr != nil {
+			if err != nil {
+				return ErrorPair{Err1: err, Err2: spErr}
+			}
+			return spErr
+		}
+	}
+
+	if err != nil {
+		span.SetAttribute("migration.ignored_sqlstate", sqlState(err))
+		if l, ok := sch.logger.(IgnoredErrorLogger); ok {
+			l.IgnoredError(m.Name(), err)
+		}
+	}
+	return nil
+}
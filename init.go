@@ -0,0 +1,40 @@
+package migration
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotInitialized is returned when the migrations table doesn't exist
+// because Init has not been called.
+var ErrNotInitialized = errors.New("migrations table not initialized")
+
+// SetAutoInit makes Apply, Rollback, FindUnapplied and their variants call
+// Init themselves instead of returning ErrNotInitialized. It's useful for
+// services that provision their own database. It's disabled by default.
+func (sch *Schema) SetAutoInit(enabled bool) {
+	sch.autoInit = enabled
+}
+
+// ensureInit makes sure the migrations table exists, calling Init if auto
+// initialization is enabled.
+func (sch *Schema) ensureInit(ctx context.Context) error {
+	return sch.ensureInitIn(ctx, sch.db)
+}
+
+// ensureInitIn is like ensureInit but runs the statements with db, e.g. in
+// the transaction of Simulate, so that the table it creates is rolled back.
+func (sch *Schema) ensureInitIn(ctx context.Context, db initDB) error {
+	if sch.autoInit {
+		return sch.init(ctx, db)
+	}
+
+	exists, err := sch.tableExistsIn(ctx, db)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotInitialized
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ErrIntegrity is returned by VerifyIntegrity when the migrations table is
+// corrupted. Duplicates are the names recorded more than once and Incomplete
+// the names of records without applied_at, both sorted. Nameless is the
+// number of records without a name, which can't be listed.
+type ErrIntegrity struct {
+	Duplicates []string
+	Incomplete []string
+	Nameless   int
+}
+
+// Error implements the error interface for ErrIntegrity.
+func (err ErrIntegrity) Error() string {
+	var problems []string
+	if len(err.Duplicates) > 0 {
+		problems = append(problems, "duplicate records: "+strings.Join(err.Duplicates, ", "))
+	}
+	if len(err.Incomplete) > 0 {
+		problems = append(problems, "records without applied_at: "+strings.Join(err.Incomplete, ", "))
+	}
+	if err.Nameless > 0 {
+		problems = append(problems, fmt.Sprintf("%d records without a name", err.Nameless))
+	}
+	return fmt.Sprintf("migrations table corrupted: %s", strings.Join(problems, "; "))
+}
+
+var _ error = ErrIntegrity{}
+
+// VerifyIntegrity checks that every record in the migrations table has a name
+// and applied_at and that no name is recorded twice. The table Init creates
+// only makes names unique, and even that doesn't hold if the constraint was
+// dropped, so records made or edited by hand can break any of it. It returns
+// ErrIntegrity listing the offending records if so. It only reads the table.
+func (sch *Schema) VerifyIntegrity() error {
+	return sch.VerifyIntegrityContext(context.Background())
+}
+
+// VerifyIntegrityContext is like VerifyIntegrity but uses ctx for the
+// queries.
+func (sch *Schema) VerifyIntegrityContext(ctx context.Context) error {
+	name := sch.col(sch.cols.Name)
+
+	dups, err := sch.queryNames(ctx, `WHERE `+name+` IS NOT NULL GROUP BY `+name+` HAVING COUNT(*) > 1 ORDER BY `+name, 0)
+	if err != nil {
+		return err
+	}
+
+	incomplete, nameless, err := sch.queryIncomplete(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(dups) > 0 || len(incomplete) > 0 || nameless > 0 {
+		return ErrIntegrity{Duplicates: dups, Incomplete: incomplete, Nameless: nameless}
+	}
+	return nil
+}
+
+// queryIncomplete returns the sorted names of records without applied_at and
+// the number of records without a name.
+func (sch *Schema) queryIncomplete(ctx context.Context) (incomplete []string, nameless int, err error) {
+	name, appliedAt := sch.col(sch.cols.Name), sch.col(sch.cols.AppliedAt)
+	q := `SELECT ` + name + `, ` + appliedAt + ` FROM ` + sch.table() +
+		` WHERE ` + name + ` IS NULL OR ` + appliedAt + ` IS NULL ORDER BY ` + name
+
+	rows, err := sch.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer func() {
+		closeErr := rows.Close()
+		if closeErr != nil {
+			if err != nil {
+				err = ErrorPair{Err1: err, Err2: closeErr}
+			} else {
+				err = closeErr
+			}
+		}
+	}()
+
+	for rows.Next() {
+		var n sql.NullString
+		var at sql.NullTime
+		if err := rows.Scan(&n, &at); err != nil {
+			return nil, 0, err
+		}
+
+		if !n.Valid {
+			nameless++
+		} else if !at.Valid {
+			incomplete = append(incomplete, n.String)
+		}
+	}
+
+	return incomplete, nameless, rows.Err()
+}
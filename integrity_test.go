@@ -0,0 +1,55 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVerifyIntegrity(t *testing.T) {
+	now := time.Now()
+	for _, tt := range []struct {
+		name    string
+		rows    []fakeRow
+		wantErr error
+	}{
+		{
+			name: "intact",
+			rows: []fakeRow{
+				{"name": "1", "applied_at": now},
+			},
+		},
+		{
+			name: "duplicates",
+			rows: []fakeRow{
+				{"name": "1", "applied_at": now},
+				{"name": "1", "applied_at": now},
+				{"applied_at": now},
+				{"applied_at": now},
+			},
+			wantErr: ErrIntegrity{Duplicates: []string{"1"}, Nameless: 2},
+		},
+		{
+			name: "incomplete",
+			rows: []fakeRow{
+				{"name": "2"},
+				{"name": "1", "applied_at": now},
+				{"name": "0"},
+				{},
+			},
+			wantErr: ErrIntegrity{Incomplete: []string{"0", "2"}, Nameless: 1},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sch, fdb := newTestSchema(t)
+			for _, row := range tt.rows {
+				fdb.insertRaw(testTable, row)
+			}
+
+			err := sch.VerifyIntegrity()
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package migration
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// timeOrNil returns nil for the zero time and &t otherwise, so that zero
+// times are marshaled as null.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// MarshalJSON implements json.Marshaler for MigrationStatus. Timestamps are
+// RFC 3339 strings, pending migrations have a null applied_at.
+func (s MigrationStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name      string     `json:"name"`
+		Applied   bool       `json:"applied"`
+		AppliedAt *time.Time `json:"applied_at"`
+	}{
+		Name:      s.Name,
+		Applied:   s.Applied,
+		AppliedAt: timeOrNil(s.AppliedAt),
+	})
+}
+
+var _ json.Marshaler = MigrationStatus{}
+
+// MarshalJSON implements json.Marshaler for Result. Timestamps are RFC 3339
+// strings, rows_affected is an object keyed by name or null, and failed is
+// null unless a migration failed.
+func (r Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Applied      []string         `json:"applied"`
+		Skipped      []string         `json:"skipped"`
+		Retries      int              `json:"retries"`
+		RowsAffected map[string]int64 `json:"rows_affected"`
+		Pending      int              `json:"pending"`
+		Executed     int              `json:"executed"`
+		Failed       *string          `json:"failed"`
+		StartedAt    *time.Time       `json:"started_at"`
+		FinishedAt   *time.Time       `json:"finished_at"`
+	}{
+		Applied:      nonNil(r.AppliedNames),
+		Skipped:      nonNil(r.Skipped),
+		Retries:      r.Retries,
+		RowsAffected: r.RowsAffected,
+		Pending:      r.Pending,
+		Executed:     r.Executed,
+		Failed:       stringOrNil(r.Failed),
+		StartedAt:    timeOrNil(r.StartedAt),
+		FinishedAt:   timeOrNil(r.FinishedAt),
+	})
+}
+
+var _ json.Marshaler = Result{}
+
+// nonNil returns an empty slice for nil, so that it's marshaled as [].
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// stringOrNil returns nil for an empty string, so that it's marshaled as null.
+func stringOrNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
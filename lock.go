@@ -0,0 +1,216 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotLocked is returned by Unlock when the schema is not locked.
+var ErrNotLocked = errors.New("schema not locked")
+
+// lockKey returns the advisory lock key of the migrations table.
+func (sch *Schema) lockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte(sch.migTableSchema + "." + sch.migTableName))
+	return int64(h.Sum64())
+}
+
+// Lock acquires a session-level PostgreSQL advisory lock keyed on the
+// migrations table, blocking until it's available. The lock is held on a
+// dedicated connection, so the pool must allow at least one more connection
+// for the migrations themselves. Every successful Lock must be followed by
+// Unlock.
+//
+// A session-level lock lives as long as the connection does: if the process
+// hangs or its connection is leaked between Lock and Unlock, other processes
+// block until the server notices the connection is gone, which may take long
+// behind a connection pooler. Prefer the transaction-level lock Apply and
+// Rollback take by default (see SetTxLock), and use Lock only when several
+// calls must run under one lock.
+func (sch *Schema) Lock(ctx context.Context) error {
+	sch.lockMu.Lock()
+
+	conn, err := sch.db.Conn(ctx)
+	if err != nil {
+		sch.lockMu.Unlock()
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, sch.lockKey())
+	if err != nil {
+		closeErr := conn.Close()
+		sch.lockMu.Unlock()
+		if closeErr != nil {
+			return ErrorPair{Err1: err, Err2: closeErr}
+		}
+		return err
+	}
+
+	sch.lockConn = conn
+	atomic.StoreInt32(&sch.locked, 1)
+	return nil
+}
+
+// Unlock releases the lock acquired by Lock.
+func (sch *Schema) Unlock() error {
+	conn := sch.lockConn
+	if conn == nil {
+		return ErrNotLocked
+	}
+	sch.lockConn = nil
+	atomic.StoreInt32(&sch.locked, 0)
+	defer sch.lockMu.Unlock()
+
+	_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, sch.lockKey())
+	closeErr := conn.Close()
+	if err != nil {
+		if closeErr != nil {
+			return ErrorPair{Err1: err, Err2: closeErr}
+		}
+		return err
+	}
+	return closeErr
+}
+
+// SetAutoLock makes Apply, ApplyEach, Rollback and RollbackEach (and their
+// variants) hold the lock acquired by Lock while they run. It's disabled by
+// default.
+func (sch *Schema) SetAutoLock(enabled bool) {
+	sch.autoLock = enabled
+}
+
+// withLock calls f holding the lock if auto locking is enabled. The lock is
+// released even if f panics.
+func (sch *Schema) withLock(ctx context.Context, f func() (int, error)) (n int, err error) {
+	if !sch.autoLock {
+		return f()
+	}
+
+	err = sch.Lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		unlockErr := sch.Unlock()
+		if unlockErr != nil {
+			if err != nil {
+				err = ErrorPair{Err1: err, Err2: unlockErr}
+			} else {
+				err = unlockErr
+			}
+		}
+	}()
+
+	return f()
+}
+
+// SetTxLock controls whether every transaction of Apply, Rollback and their
+// variants acquires a transaction-level advisory lock keyed on the migrations
+// table before running migrations. The lock is released on commit or
+// rollback, so a crashed process can't leave it held. It's taken only if the
+// dialect implements TxLocker and while Lock isn't held by sch. It's enabled
+// by default.
+//
+// Once it has the lock, a transaction of Apply reads the applied migrations
+// again and skips those a concurrent Apply applied while it was waiting, so
+// processes starting together apply each migration once. A batch split by
+// NonTransactional migrations locks each transaction on its own. Without the
+// lock, concurrent processes recording migrations at the same time may number
+// them alike, and the unique id column then fails all but one of them.
+func (sch *Schema) SetTxLock(enabled bool) {
+	sch.noTxLock = !enabled
+}
+
+// lockTx acquires the transaction-level lock in tx if it's enabled.
+func (sch *Schema) lockTx(ctx context.Context, tx *sql.Tx) error {
+	l, ok := sch.dialect.(TxLocker)
+	if !ok || sch.noTxLock || atomic.LoadInt32(&sch.locked) == 1 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, l.TxLock(), sch.lockKey())
+	return err
+}
+
+// LockHolder is a PostgreSQL backend holding the advisory lock of a schema.
+type LockHolder struct {
+	PID             int
+	ApplicationName string
+	ClientAddr      string // empty for Unix socket connections
+	BackendStart    time.Time
+}
+
+// LockHolders returns the backends holding the advisory lock of sch, taken
+// either by Lock or by the transaction lock, as reported by pg_locks.
+func (sch *Schema) LockHolders(ctx context.Context) (res []LockHolder, err error) {
+	key := uint64(sch.lockKey())
+	q := `SELECT l.pid, COALESCE(a.application_name, ''), COALESCE(host(a.client_addr), ''), a.backend_start ` +
+		`FROM pg_locks l LEFT JOIN pg_stat_activity a ON a.pid = l.pid ` +
+		`WHERE l.locktype = 'advisory' AND l.granted ` +
+		`AND l.classid::bigint = $1 AND l.objid::bigint = $2 AND l.objsubid = 1`
+
+	rows, err := sch.db.QueryContext(ctx, q, int64(key>>32), int64(key&0xffffffff))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		closeErr := rows.Close()
+		if closeErr != nil {
+			if err != nil {
+				err = ErrorPair{Err1: err, Err2: closeErr}
+			} else {
+				err = closeErr
+			}
+		}
+	}()
+
+	for rows.Next() {
+		var h LockHolder
+		var backendStart sql.NullTime
+		if err := rows.Scan(&h.PID, &h.ApplicationName, &h.ClientAddr, &backendStart); err != nil {
+			return nil, err
+		}
+
+		h.BackendStart = backendStart.Time
+		res = append(res, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ForceUnlock releases the advisory lock of sch held by any session, e.g. by
+// a migrator that hung, including the one of sch's own Lock. An advisory lock
+// can only be released by the session holding it, so ForceUnlock terminates
+// the backends returned by LockHolders, rolling back whatever they were
+// doing. It returns the number of terminated backends. The role needs the
+// right to terminate them.
+func (sch *Schema) ForceUnlock(ctx context.Context) (int, error) {
+	holders, err := sch.LockHolders(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, h := range holders {
+		var ok bool
+		err = sch.db.QueryRowContext(ctx, `SELECT pg_terminate_backend($1)`, h.PID).Scan(&ok)
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			n++
+		}
+	}
+
+	return n, nil
+}
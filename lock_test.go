@@ -0,0 +1,157 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockBlocks(t *testing.T) {
+	db, _ := newFakeDB(t)
+	sch1 := NewSchema(db, DefaultSchemaName, DefaultMigrationTableName)
+	sch2 := NewSchema(db, DefaultSchemaName, DefaultMigrationTableName)
+	ctx := context.Background()
+
+	if err := sch1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan error)
+	go func() {
+		locked <- sch2.Lock(ctx)
+	}()
+
+	select {
+	case err := <-locked:
+		t.Fatalf("second Lock returned %v while the first one is held", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := sch1.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second Lock still blocks after Unlock")
+	}
+
+	if err := sch2.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sch2.Unlock(); err != ErrNotLocked {
+		t.Errorf("got %v unlocking twice, want ErrNotLocked", err)
+	}
+}
+
+func TestAutoLockReleasedOnPanic(t *testing.T) {
+	sch, _ := newTestSchema(t)
+	sch.SetAutoLock(true)
+
+	m := Struct{
+		NameString: "1",
+		ApplyFunc: func(tx *sql.Tx) error {
+			panic("boom")
+		},
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Apply didn't panic")
+			}
+		}()
+		sch.Apply([]Migration{m})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	other := sch.WithTable(DefaultMigrationTableName)
+	if err := other.Lock(ctx); err != nil {
+		t.Fatalf("lock is still held after the panic: %v", err)
+	}
+	if err := other.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrentApply(t *testing.T) {
+	db, fdb := newFakeDB(t)
+	sch1 := NewSchema(db, DefaultSchemaName, DefaultMigrationTableName)
+	sch2 := NewSchema(db, DefaultSchemaName, DefaultMigrationTableName)
+	if err := sch1.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first Apply to take the lock waits in its first migration until
+	// the other one has read the migrations table and waits for the lock.
+	waiting := make(chan struct{})
+	var mu sync.Mutex
+	locks := 0
+	fdb.setHook(func(q string) error {
+		mu.Lock()
+		if strings.HasPrefix(q, "SELECT pg_advisory_xact_lock") {
+			if locks++; locks == 2 {
+				close(waiting)
+			}
+		}
+		first := q == "APPLY 1" && locks == 1
+		mu.Unlock()
+
+		if first {
+			select {
+			case <-waiting:
+			case <-time.After(time.Second):
+				return errors.New("the other Apply doesn't wait for the lock")
+			}
+		}
+		return nil
+	})
+
+	migs := testMigrations("1", "2")
+	type result struct {
+		res *Result
+		err error
+	}
+	results := make(chan result, 2)
+	for _, sch := range []*Schema{sch1, sch2} {
+		go func(sch *Schema) {
+			res, err := sch.ApplyResult(migs)
+			results <- result{res: res, err: err}
+		}(sch)
+	}
+
+	var applied, skipped []string
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		applied = append(applied, r.res.AppliedNames...)
+		skipped = append(skipped, r.res.Skipped...)
+	}
+
+	want := []string{"1", "2"}
+	if !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied %q in total, want %q", applied, want)
+	}
+	if !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped %q in total, want %q", skipped, want)
+	}
+	if got := fdb.names(testTable); !reflect.DeepEqual(got, want) {
+		t.Errorf("recorded %q, want %q", got, want)
+	}
+	if got := fdb.executed("APPLY "); !reflect.DeepEqual(got, []string{"APPLY 1", "APPLY 2"}) {
+		t.Errorf("ran %q, want every migration once", got)
+	}
+}
@@ -0,0 +1,29 @@
+package migration
+
+import "time"
+
+// Logger receives events about migrations being applied and rolled back.
+type Logger interface {
+	BeforeApply(name string)
+	AfterApply(name string, d time.Duration)
+	BeforeRollback(name string)
+	AfterRollback(name string, d time.Duration)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) BeforeApply(name string)                    {}
+func (nopLogger) AfterApply(name string, d time.Duration)    {}
+func (nopLogger) BeforeRollback(name string)                 {}
+func (nopLogger) AfterRollback(name string, d time.Duration) {}
+
+var _ Logger = nopLogger{}
+
+// SetLogger sets the logger. A nil logger disables logging, which is the
+// default.
+func (sch *Schema) SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	sch.logger = l
+}
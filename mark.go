@@ -0,0 +1,116 @@
+package migration
+
+import "context"
+
+// MarkApplied records the migration named name as applied without running
+// it, e.g. after it was applied by hand. The record has no checksum and no
+// duration. It's made in a transaction taking the transaction lock like
+// Apply.
+func (sch *Schema) MarkApplied(name string) error {
+	return sch.MarkAppliedContext(context.Background(), name)
+}
+
+// MarkAppliedContext is like MarkApplied but uses ctx for the queries.
+func (sch *Schema) MarkAppliedContext(ctx context.Context, name string) error {
+	if name == "" {
+		return ErrEmptyName
+	}
+
+	err := sch.ensureInit(ctx)
+	if err != nil {
+		return err
+	}
+
+	return sch.recordTx(ctx, name, sch.clock.Now(), nil, nil)
+}
+
+// MarkRolledBack deletes the record of the migration named name without
+// rolling it back. It returns ErrNotApplied if there is no such record.
+func (sch *Schema) MarkRolledBack(name string) error {
+	return sch.MarkRolledBackContext(context.Background(), name)
+}
+
+// MarkRolledBackContext is like MarkRolledBack but uses ctx for the query.
+func (sch *Schema) MarkRolledBackContext(ctx context.Context, name string) error {
+	res, err := sch.db.ExecContext(ctx, sch.queries.delete, name)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotApplied{Name: name}
+	}
+	return nil
+}
+
+// Baseline records every migration up to and including the one named
+// uptoName as applied without running them, in order, in a single
+// transaction. It's the way to adopt the package on a database whose schema
+// already exists, so that Migrate only applies newer migrations afterwards.
+// Migrations that are already recorded are left untouched. The records have
+// checksums but no duration. It returns ErrMigrationNotFound if there is no
+// uptoName in migrations.
+func (sch *Schema) Baseline(migrations []Migration, uptoName string) error {
+	return sch.BaselineContext(context.Background(), migrations, uptoName)
+}
+
+// BaselineContext is like Baseline but uses ctx for the queries and the
+// transaction.
+func (sch *Schema) BaselineContext(ctx context.Context, migrations []Migration, uptoName string) error {
+	set, err := NewMigrationSet(migrations)
+	if err != nil {
+		return err
+	}
+	if set.ByName(uptoName) == nil {
+		return ErrMigrationNotFound
+	}
+
+	_, err = sch.withLock(ctx, func() (int, error) {
+		return 0, sch.baseline(ctx, set, uptoName)
+	})
+	return err
+}
+
+// baseline records the migrations of set up to uptoName that are not applied.
+func (sch *Schema) baseline(ctx context.Context, set *MigrationSet, uptoName string) (err error) {
+	err = sch.ensureInit(ctx)
+	if err != nil {
+		return err
+	}
+
+	applied, err := sch.queryAppliedNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := sch.clock.Now()
+	batch := &recordBatch{}
+	for _, m := range set.migrations {
+		if !applied[m.Name()] {
+			batch.add(m.Name(), now, checksumOf(m), nil)
+		}
+		if m.Name() == uptoName {
+			break
+		}
+	}
+
+	tx, err := beginTx(ctx, sch.db, sch.txOptions())
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = endTx(ctx, tx, err, err == nil)
+	}()
+
+	err = sch.prepareTx(ctx, tx, false)
+	if err != nil {
+		return err
+	}
+
+	return sch.flushBatch(ctx, tx, batch)
+}
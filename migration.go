@@ -1,6 +1,10 @@
 package migration
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
 
 // Migration is a migration interface. A migration can apply itself, rollback
 // itself and has a unique name.
@@ -11,20 +15,37 @@ type Migration interface {
 	Name() string
 }
 
-// Struct is a simple implementation of the Migration interface.
+// Struct is a simple implementation of the Migration interface. ApplyDryFunc
+// and RollbackDryFunc are optional and are only called in dry runs. An
+// irreversible Struct needs no RollbackFunc. DependsOnList names the
+// migrations the Struct depends on.
 type Struct struct {
-	NameString   string
-	ApplyFunc    func(tx *sql.Tx) error
-	RollbackFunc func(tx *sql.Tx) error
+	NameString      string
+	ApplyFunc       func(tx *sql.Tx) error
+	RollbackFunc    func(tx *sql.Tx) error
+	ApplyDryFunc    func(tx *sql.Tx) error
+	RollbackDryFunc func(tx *sql.Tx) error
+	IsIrreversible  bool
+	TagList         []string
+	DependsOnList   []string
 }
 
 // Apply implements Migration for Struct.
 func (s Struct) Apply(tx *sql.Tx) error {
+	if s.ApplyFunc == nil {
+		return ErrNilApplyFunc{Name: s.NameString}
+	}
 	return s.ApplyFunc(tx)
 }
 
 // Rollback implements Migration for Struct.
 func (s Struct) Rollback(tx *sql.Tx) error {
+	if s.IsIrreversible {
+		return ErrIrreversible{Name: s.NameString}
+	}
+	if s.RollbackFunc == nil {
+		return ErrNilRollbackFunc{Name: s.NameString}
+	}
 	return s.RollbackFunc(tx)
 }
 
@@ -33,12 +54,245 @@ func (s Struct) Name() string {
 	return s.NameString
 }
 
+// ApplyDry implements DryMigration for Struct.
+func (s Struct) ApplyDry(tx *sql.Tx) error {
+	if s.ApplyDryFunc == nil {
+		return nil
+	}
+	return s.ApplyDryFunc(tx)
+}
+
+// RollbackDry implements DryMigration for Struct.
+func (s Struct) RollbackDry(tx *sql.Tx) error {
+	if s.RollbackDryFunc == nil {
+		return nil
+	}
+	return s.RollbackDryFunc(tx)
+}
+
+// Irreversible implements IrreversibleMigration for Struct.
+func (s Struct) Irreversible() bool {
+	return s.IsIrreversible
+}
+
+// Tags implements Tagged for Struct.
+func (s Struct) Tags() []string {
+	return s.TagList
+}
+
+// DependsOn implements Dependent for Struct.
+func (s Struct) DependsOn() []string {
+	return s.DependsOnList
+}
+
 var _ Migration = Struct{}
+var _ DryMigration = Struct{}
+var _ IrreversibleMigration = Struct{}
+var _ Tagged = Struct{}
+var _ Dependent = Struct{}
+
+// ErrNilApplyFunc is returned by Struct.Apply when ApplyFunc is nil.
+type ErrNilApplyFunc struct {
+	Name string
+}
+
+// Error implements the error interface for ErrNilApplyFunc.
+func (err ErrNilApplyFunc) Error() string {
+	return fmt.Sprintf("migration has no apply func: %q", err.Name)
+}
+
+var _ error = ErrNilApplyFunc{}
+
+// ErrNilRollbackFunc is returned by Struct.Rollback when RollbackFunc is nil.
+type ErrNilRollbackFunc struct {
+	Name string
+}
+
+// Error implements the error interface for ErrNilRollbackFunc.
+func (err ErrNilRollbackFunc) Error() string {
+	return fmt.Sprintf("migration has no rollback func: %q", err.Name)
+}
+
+var _ error = ErrNilRollbackFunc{}
+
+// IrreversibleMigration is a Migration that may be impossible to roll back.
+// Schema refuses to roll back a batch containing a migration whose
+// Irreversible returns true.
+type IrreversibleMigration interface {
+	Migration
+
+	Irreversible() bool
+}
+
+// ErrIrreversible is returned when rolling back an irreversible migration.
+type ErrIrreversible struct {
+	Name string
+}
+
+// Error implements the error interface for ErrIrreversible.
+func (err ErrIrreversible) Error() string {
+	return fmt.Sprintf("migration is irreversible: %q", err.Name)
+}
+
+var _ error = ErrIrreversible{}
+
+func isIrreversible(m Migration) bool {
+	im, ok := m.(IrreversibleMigration)
+	return ok && im.Irreversible()
+}
+
+// ContextMigration is a Migration that accepts a context. Schema's *Context
+// methods call ApplyContext and RollbackContext instead of Apply and Rollback
+// for migrations implementing this interface.
+type ContextMigration interface {
+	Migration
+
+	ApplyContext(ctx context.Context, tx *sql.Tx) error
+	RollbackContext(ctx context.Context, tx *sql.Tx) error
+}
+
+// DryMigration is a Migration that supports dry runs. In a dry run Schema
+// calls ApplyDry and RollbackDry instead of Apply and Rollback. Migrations that
+// don't implement DryMigration are skipped in dry runs.
+type DryMigration interface {
+	Migration
+
+	ApplyDry(tx *sql.Tx) error
+	RollbackDry(tx *sql.Tx) error
+}
+
+// NonTransactional is a Migration that can't run inside a transaction, e.g. one
+// using CREATE INDEX CONCURRENTLY. Schema calls ApplyNoTx and RollbackNoTx
+// instead of Apply and Rollback for such migrations, outside of any
+// transaction, so they can't be rolled back atomically with other migrations.
+type NonTransactional interface {
+	Migration
+
+	ApplyNoTx(ctx context.Context, db DB) error
+	RollbackNoTx(ctx context.Context, db DB) error
+}
+
+// RowsMigration is a Migration reporting the number of rows it affected, e.g.
+// a data backfill. Schema calls ApplyRows instead of Apply and reports the
+// number in Result.RowsAffected. A negative number means it's unknown and is
+// left out.
+type RowsMigration interface {
+	Migration
+
+	ApplyRows(ctx context.Context, tx *sql.Tx) (int64, error)
+}
+
+// Validator is a Migration that can check its preconditions, e.g. that a
+// column it drops is unused. Before applying any migration of a transaction,
+// Schema calls Validate of every Validator in it, dry runs included, so a
+// failed check leaves the whole transaction unapplied. The checks see the
+// database as it is before the transaction, not after the migrations
+// preceding the Validator.
+type Validator interface {
+	Migration
+
+	Validate(tx *sql.Tx) error
+}
+
+// validateAll calls Validate of every Validator in migrations in order.
+func validateAll(tx *sql.Tx, migrations []Migration) error {
+	for _, m := range migrations {
+		if v, ok := m.(Validator); ok {
+			if err := v.Validate(tx); err != nil {
+				return failed(m.Name(), OpValidate, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ErrNonTransactional is returned when a NonTransactional migration is passed
+// where only migrations running in a transaction are supported.
+type ErrNonTransactional struct {
+	Name string
+}
+
+// Error implements the error interface for ErrNonTransactional.
+func (err ErrNonTransactional) Error() string {
+	return fmt.Sprintf("migration is non-transactional: %q", err.Name)
+}
+
+var _ error = ErrNonTransactional{}
+
+func isNonTransactional(m Migration) bool {
+	_, ok := m.(NonTransactional)
+	return ok
+}
+
+func applyMigration(ctx context.Context, tx *sql.Tx, m Migration, isDry bool) error {
+	if isDry {
+		if dm, ok := m.(DryMigration); ok {
+			return dm.ApplyDry(tx)
+		}
+		return nil
+	}
+	if cm, ok := m.(ContextMigration); ok {
+		return cm.ApplyContext(ctx, tx)
+	}
+	return m.Apply(tx)
+}
+
+func rollbackMigration(ctx context.Context, tx *sql.Tx, m Migration, isDry bool) error {
+	if isDry {
+		if dm, ok := m.(DryMigration); ok {
+			return dm.RollbackDry(tx)
+		}
+		return nil
+	}
+	if cm, ok := m.(ContextMigration); ok {
+		return cm.RollbackContext(ctx, tx)
+	}
+	return m.Rollback(tx)
+}
+
+// Ordered is a Migration with an explicit order. Migrations are sorted by
+// order and then by name, and migrations that aren't Ordered have order 0.
+// It's useful when names don't sort in the intended order.
+type Ordered interface {
+	Migration
+
+	Order() int
+}
+
+func orderOf(m Migration) int {
+	if o, ok := m.(Ordered); ok {
+		return o.Order()
+	}
+	return 0
+}
+
+// Tagged is a Migration belonging to groups, such as feature areas, that can
+// be applied on their own with ApplyTag.
+type Tagged interface {
+	Migration
+
+	Tags() []string
+}
+
+// hasTag reports whether m is Tagged with tag.
+func hasTag(m Migration, tag string) bool {
+	t, ok := m.(Tagged)
+	if !ok {
+		return false
+	}
+
+	for _, tg := range t.Tags() {
+		if tg == tag {
+			return true
+		}
+	}
+	return false
+}
 
 // FindByName finds a migration by name.
 func FindByName(migrations []Migration, name string) Migration {
 	for _, m := range migrations {
-		if m.Name() == name {
+		if m != nil && m.Name() == name {
 			return m
 		}
 	}
@@ -0,0 +1,110 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStructNilFuncs(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		m       Struct
+		apply   bool
+		wantErr error
+	}{
+		{
+			name:    "apply",
+			m:       Struct{NameString: "1"},
+			apply:   true,
+			wantErr: ErrNilApplyFunc{Name: "1"},
+		},
+		{
+			name:    "rollback",
+			m:       Struct{NameString: "1"},
+			wantErr: ErrNilRollbackFunc{Name: "1"},
+		},
+		{
+			name:    "irreversible",
+			m:       Struct{NameString: "1", IsIrreversible: true},
+			wantErr: ErrIrreversible{Name: "1"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.apply {
+				err = tt.m.Apply(nil)
+			} else {
+				err = tt.m.Rollback(nil)
+			}
+			if err != tt.wantErr {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyNilApplyFunc(t *testing.T) {
+	sch, db := newTestSchema(t)
+	migs := []Migration{testMigration("1"), Struct{NameString: "2"}}
+
+	n, err := sch.Apply(migs)
+	if !errors.Is(err, ErrNilApplyFunc{Name: "2"}) {
+		t.Fatalf("got %v, want ErrNilApplyFunc", err)
+	}
+
+	var failErr ErrMigrationFailed
+	if !errors.As(err, &failErr) || failErr.Name != "2" || failErr.Op != OpApply {
+		t.Errorf("got %v, want it wrapped in ErrMigrationFailed", err)
+	}
+	if n != 0 {
+		t.Errorf("applied %d migrations, want 0", n)
+	}
+	if got := db.names(testTable); len(got) > 0 {
+		t.Errorf("recorded %q, want the transaction rolled back", got)
+	}
+}
+
+func TestCompose(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		subs    []Migration
+		wantErr error
+	}{
+		{
+			name: "transactional",
+			subs: testMigrations("a", "b"),
+		},
+		{
+			name:    "nil",
+			subs:    []Migration{testMigration("a"), nil},
+			wantErr: ErrNilMigration{Index: 1},
+		},
+		{
+			name:    "non-transactional",
+			subs:    []Migration{testMigration("a"), noTxMigration{testMigration("b")}},
+			wantErr: ErrNonTransactional{Name: "b"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sch, db := newTestSchema(t)
+			_, err := sch.Apply([]Migration{Compose("1", tt.subs...)})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				if got := db.executed("APPLY "); len(got) > 0 {
+					t.Errorf("ran %q, want nothing", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"APPLY a", "APPLY b"}
+			if got := db.executed("APPLY "); !reflect.DeepEqual(got, want) {
+				t.Errorf("ran %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Package migrationfake provides an in-memory migration.Migrator for unit
+// tests of code orchestrating migrations without a database.
+package migrationfake
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Restream/migration"
+)
+
+// Migrator is a migration.Migrator keeping the applied names in memory. It
+// never runs migrations, it only records them, in the same order as
+// migration.Schema and with the same validation. It's safe for concurrent
+// use. The zero value has nothing applied and records the zero time.
+type Migrator struct {
+	// Clock tells the time migrations are recorded at, a zero time if nil.
+	Clock migration.Clock
+
+	mu      sync.Mutex
+	applied map[string]time.Time
+}
+
+// New returns a new Migrator with the migrations named names applied.
+func New(names ...string) *Migrator {
+	f := &Migrator{}
+	f.SetApplied(names...)
+	return f
+}
+
+// SetApplied records the migrations named names as applied.
+func (f *Migrator) SetApplied(names ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	for _, name := range names {
+		f.record(name, now)
+	}
+}
+
+// IsApplied reports whether the migration named name is applied.
+func (f *Migrator) IsApplied(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, ok := f.applied[name]
+	return ok
+}
+
+// Migrate implements migration.Migrator for Migrator. It records the
+// unapplied migrations in the order migration.SortMigrations puts them in.
+func (f *Migrator) Migrate(migrations []migration.Migration) (int, error) {
+	set, err := migration.NewMigrationSet(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	now := f.now()
+	for _, m := range set.Slice() {
+		if _, ok := f.applied[m.Name()]; !ok {
+			f.record(m.Name(), now)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Rollback implements migration.Migrator for Migrator. Like Schema.Rollback,
+// it counts every passed migration and fails for irreversible ones.
+func (f *Migrator) Rollback(migrations []migration.Migration) (int, error) {
+	set, err := migration.NewMigrationSet(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range set.Slice() {
+		if im, ok := m.(migration.IrreversibleMigration); ok && im.Irreversible() {
+			return 0, migration.ErrIrreversible{Name: m.Name()}
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, m := range set.Slice() {
+		delete(f.applied, m.Name())
+	}
+
+	return set.Len(), nil
+}
+
+// Status implements migration.Migrator for Migrator.
+func (f *Migrator) Status(migrations []migration.Migration) ([]migration.MigrationStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	res := make([]migration.MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		t, ok := f.applied[m.Name()]
+		res = append(res, migration.MigrationStatus{
+			Name:      m.Name(),
+			Applied:   ok,
+			AppliedAt: t,
+		})
+	}
+
+	return res, nil
+}
+
+// Pending implements migration.Migrator for Migrator.
+func (f *Migrator) Pending(migrations []migration.Migration) (int, error) {
+	if _, err := migration.NewMigrationSet(migrations); err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, m := range migrations {
+		if _, ok := f.applied[m.Name()]; !ok {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+var _ migration.Migrator = (*Migrator)(nil)
+
+// now returns the time to record migrations at.
+func (f *Migrator) now() time.Time {
+	if f.Clock == nil {
+		return time.Time{}
+	}
+	return f.Clock.Now()
+}
+
+// record records the migration named name. f.mu must be held.
+func (f *Migrator) record(name string, t time.Time) {
+	if f.applied == nil {
+		f.applied = map[string]time.Time{}
+	}
+	f.applied[name] = t
+}
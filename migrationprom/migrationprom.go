@@ -0,0 +1,155 @@
+// Package migrationprom exports Prometheus metrics of migrations run by
+// migration.Schema. It's a separate package so that the migration package
+// itself doesn't depend on the Prometheus client.
+package migrationprom
+
+import (
+	"context"
+	"time"
+
+	"github.com/Restream/migration"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Operation label values.
+const (
+	opApply    = "apply"
+	opRollback = "rollback"
+)
+
+// Metrics is a prometheus.Collector counting migrations and timing batches.
+// Every metric is labeled by schema, and the failure and duration metrics
+// also by op, which is "apply" or "rollback":
+//
+//   - migration_applied_total counts migrations committed by batches of
+//     Apply, ApplyEach, ApplyOne and their variants, leaving out dry runs,
+//     Simulate, ApplyTx and MultiSchema, whose transactions don't commit or
+//     aren't committed by a batch;
+//   - migration_rolled_back_total counts migrations rolled back and committed
+//     by batches of Rollback and its variants, likewise;
+//   - migration_failed_total counts migrations that failed, in any run;
+//   - migration_batch_duration_seconds is a histogram of batch durations,
+//     dry runs included.
+type Metrics struct {
+	applied       *prometheus.CounterVec
+	rolledBack    *prometheus.CounterVec
+	failed        *prometheus.CounterVec
+	batchDuration *prometheus.HistogramVec
+}
+
+// New returns new Metrics. They have to be registered to be exported, e.g.
+// with prometheus.MustRegister.
+func New() *Metrics {
+	return &Metrics{
+		applied: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "migration_applied_total",
+			Help: "Number of migrations applied without an error.",
+		}, []string{"schema"}),
+		rolledBack: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "migration_rolled_back_total",
+			Help: "Number of migrations rolled back without an error.",
+		}, []string{"schema"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "migration_failed_total",
+			Help: "Number of migrations that failed to apply or roll back.",
+		}, []string{"schema", "op"}),
+		batchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "migration_batch_duration_seconds",
+			Help:    "Duration of applying or rolling back a batch of migrations.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"schema", "op"}),
+	}
+}
+
+// Describe implements prometheus.Collector for Metrics.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.applied.Describe(ch)
+	m.rolledBack.Describe(ch)
+	m.failed.Describe(ch)
+	m.batchDuration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector for Metrics.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.applied.Collect(ch)
+	m.rolledBack.Collect(ch)
+	m.failed.Collect(ch)
+	m.batchDuration.Collect(ch)
+}
+
+var _ prometheus.Collector = (*Metrics)(nil)
+
+// Tracer returns a migration.Tracer updating m with the label schema, to be
+// set with Schema.SetTracer. It replaces any other tracer of the Schema.
+func (m *Metrics) Tracer(schema string) migration.Tracer {
+	return tracer{metrics: m, schema: schema}
+}
+
+// tracer is a migration.Tracer returned by Metrics.Tracer.
+type tracer struct {
+	metrics *Metrics
+	schema  string
+}
+
+// Start implements migration.Tracer for tracer.
+func (t tracer) Start(ctx context.Context, name string) (context.Context, migration.Span) {
+	return ctx, &span{tracer: t, name: name, start: time.Now()}
+}
+
+var _ migration.Tracer = tracer{}
+
+// span is a migration.Span updating the metrics when it ends.
+type span struct {
+	tracer tracer
+	name   string
+	start  time.Time
+	// count and dry are the attributes of batch spans.
+	count int
+	dry   bool
+}
+
+// SetAttribute implements migration.Span for span.
+func (s *span) SetAttribute(key string, value interface{}) {
+	switch key {
+	case "migration.count":
+		s.count, _ = value.(int)
+	case "migration.dry":
+		s.dry, _ = value.(bool)
+	}
+}
+
+// End implements migration.Span for span. Migrations are counted as done by
+// the batch, once committed, rather than by their own spans, which end
+// before the transaction does.
+func (s *span) End(err error) {
+	m, schema := s.tracer.metrics, s.tracer.schema
+	switch s.name {
+	case "migration.apply":
+		s.countFailed(opApply, err)
+	case "migration.rollback":
+		s.countFailed(opRollback, err)
+	case "migration.apply_batch":
+		s.countBatch(m.applied)
+		m.batchDuration.WithLabelValues(schema, opApply).Observe(time.Since(s.start).Seconds())
+	case "migration.rollback_batch":
+		s.countBatch(m.rolledBack)
+		m.batchDuration.WithLabelValues(schema, opRollback).Observe(time.Since(s.start).Seconds())
+	}
+}
+
+// countFailed increments the failures of op if err is not nil.
+func (s *span) countFailed(op string, err error) {
+	if err != nil {
+		s.tracer.metrics.failed.WithLabelValues(s.tracer.schema, op).Inc()
+	}
+}
+
+// countBatch adds the migrations committed by a batch to done unless it's a
+// dry run. A failed batch may have committed some of them too.
+func (s *span) countBatch(done *prometheus.CounterVec) {
+	if !s.dry {
+		done.WithLabelValues(s.tracer.schema).Add(float64(s.count))
+	}
+}
+
+var _ migration.Span = (*span)(nil)
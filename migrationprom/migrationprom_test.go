@@ -0,0 +1,102 @@
+package migrationprom
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	type batch struct {
+		name   string
+		dry    bool
+		count  int
+		failed int // migrations failing in the batch
+		err    error
+	}
+	for _, tt := range []struct {
+		name           string
+		batches        []batch
+		wantApplied    float64
+		wantRolledBack float64
+		wantFailed     float64
+	}{
+		{
+			name:        "committed",
+			batches:     []batch{{name: "migration.apply_batch", count: 3}},
+			wantApplied: 3,
+		},
+		{
+			name:    "dry",
+			batches: []batch{{name: "migration.apply_batch", dry: true, count: 3}},
+		},
+		{
+			name: "failed",
+			batches: []batch{
+				{name: "migration.apply_batch", failed: 1, err: errFailed},
+			},
+			wantFailed: 1,
+		},
+		{
+			name: "partly committed",
+			batches: []batch{
+				{name: "migration.apply_batch", count: 2, failed: 1, err: errFailed},
+			},
+			wantApplied: 2,
+			wantFailed:  1,
+		},
+		{
+			name: "rollback",
+			batches: []batch{
+				{name: "migration.rollback_batch", count: 2},
+				{name: "migration.rollback_batch", dry: true, count: 2},
+			},
+			wantRolledBack: 2,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New()
+			tr := m.Tracer("s")
+			ctx := context.Background()
+
+			for _, b := range tt.batches {
+				_, span := tr.Start(ctx, b.name)
+				span.SetAttribute("migration.dry", b.dry)
+
+				op := "migration.apply"
+				if b.name == "migration.rollback_batch" {
+					op = "migration.rollback"
+				}
+				// Migrations run without an error whether or not they are
+				// committed afterwards.
+				for i := 0; i < b.count+1; i++ {
+					_, s := tr.Start(ctx, op)
+					s.End(nil)
+				}
+				for i := 0; i < b.failed; i++ {
+					_, s := tr.Start(ctx, op)
+					s.End(errFailed)
+				}
+
+				span.SetAttribute("migration.count", b.count)
+				span.End(b.err)
+			}
+
+			if got := testutil.ToFloat64(m.applied.WithLabelValues("s")); got != tt.wantApplied {
+				t.Errorf("applied %v, want %v", got, tt.wantApplied)
+			}
+			if got := testutil.ToFloat64(m.rolledBack.WithLabelValues("s")); got != tt.wantRolledBack {
+				t.Errorf("rolled back %v, want %v", got, tt.wantRolledBack)
+			}
+			failed := testutil.ToFloat64(m.failed.WithLabelValues("s", opApply)) +
+				testutil.ToFloat64(m.failed.WithLabelValues("s", opRollback))
+			if failed != tt.wantFailed {
+				t.Errorf("failed %v, want %v", failed, tt.wantFailed)
+			}
+		})
+	}
+}
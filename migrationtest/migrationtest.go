@@ -0,0 +1,78 @@
+// Package migrationtest provides helpers for testing migrations against a
+// real database.
+package migrationtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Restream/migration"
+)
+
+// TestRoundTrip checks that every migration's rollback reverses its apply.
+// With the default migrations table in db, it applies each migration in
+// order, rolls it back, checks its record is gone and applies it again, so
+// that the following migrations run against the schema they expect.
+// Irreversible migrations are only applied. It returns an error naming the
+// first migration whose round trip fails. Migrations that succeed stay
+// applied.
+func TestRoundTrip(db migration.DB, migrations []migration.Migration) error {
+	return TestRoundTripContext(context.Background(), db, migrations)
+}
+
+// TestRoundTripContext is like TestRoundTrip but uses ctx for the queries and
+// the transactions.
+func TestRoundTripContext(ctx context.Context, db migration.DB, migrations []migration.Migration) error {
+	sch := migration.NewSchema(db, migration.DefaultSchemaName, migration.DefaultMigrationTableName)
+	err := sch.InitContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	migs, err := sch.FindUnappliedContext(ctx, migrations)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migs {
+		err = roundTrip(ctx, sch, m)
+		if err != nil {
+			return fmt.Errorf("round trip of migration %q: %w", m.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+var errRecordLeft = errors.New("record is left in the migrations table after rollback")
+
+// roundTrip applies m, rolls it back and applies it again.
+func roundTrip(ctx context.Context, sch *migration.Schema, m migration.Migration) error {
+	one := []migration.Migration{m}
+
+	_, err := sch.ApplyContext(ctx, one)
+	if err != nil {
+		return err
+	}
+
+	if im, ok := m.(migration.IrreversibleMigration); ok && im.Irreversible() {
+		return nil
+	}
+
+	_, err = sch.RollbackContext(ctx, one)
+	if err != nil {
+		return err
+	}
+
+	applied, err := sch.FindAppliedContext(ctx, one)
+	if err != nil {
+		return err
+	}
+	if len(applied) > 0 {
+		return errRecordLeft
+	}
+
+	_, err = sch.ApplyContext(ctx, one)
+	return err
+}
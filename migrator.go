@@ -0,0 +1,13 @@
+package migration
+
+// Migrator is the part of Schema that application code orchestrating
+// migrations usually needs, so that it can be replaced in tests, e.g. by the
+// in-memory fake of the migrationfake package.
+type Migrator interface {
+	Migrate(migrations []Migration) (int, error)
+	Rollback(migrations []Migration) (int, error)
+	Status(migrations []Migration) ([]MigrationStatus, error)
+	Pending(migrations []Migration) (int, error)
+}
+
+var _ Migrator = (*Schema)(nil)
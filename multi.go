@@ -0,0 +1,204 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ErrDifferentDBs is returned by NewMultiSchema when the schemas don't share a
+// database.
+var ErrDifferentDBs = errors.New("schemas use different databases")
+
+// MultiSchema is a group of schemas of a single database that are migrated
+// together.
+type MultiSchema struct {
+	db      DB
+	schemas []*Schema
+}
+
+// NewMultiSchema returns a new MultiSchema. All schemas must share the same
+// DB. It returns ErrDifferentDBs unless they do: DB values must be equal, or,
+// for maps and slices, which aren't comparable, refer to the same data.
+// Other values that aren't comparable, e.g. structs holding a slice, can't be
+// told apart and are taken for different databases.
+func NewMultiSchema(schemas ...*Schema) (*MultiSchema, error) {
+	ms := &MultiSchema{schemas: schemas}
+	for _, sch := range schemas {
+		if ms.db == nil {
+			ms.db = sch.db
+		}
+		if !sameDB(sch.db, ms.db) {
+			return nil, ErrDifferentDBs
+		}
+	}
+	return ms, nil
+}
+
+// sameDB reports whether a and b are known to be the same DB without
+// comparing values that aren't comparable, which would panic.
+func sameDB(a, b DB) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if !va.IsValid() || !vb.IsValid() {
+		return va.IsValid() == vb.IsValid()
+	}
+	if va.Type() != vb.Type() {
+		return false
+	}
+	if va.Comparable() && vb.Comparable() {
+		return a == b
+	}
+
+	switch va.Kind() {
+	case reflect.Map:
+		return va.Pointer() == vb.Pointer()
+	case reflect.Slice:
+		return va.Pointer() == vb.Pointer() && va.Len() == vb.Len()
+	default:
+		return false
+	}
+}
+
+// Apply applies migrations[i] to the i-th schema, all in a single
+// transaction, so either every schema advances or none does. Migrations that
+// are already applied are skipped like in Schema.Apply. It returns the number
+// of applied migrations per schema and error if any. NonTransactional
+// migrations are not supported.
+func (ms *MultiSchema) Apply(migrations [][]Migration) ([]int, error) {
+	return ms.ApplyContext(context.Background(), migrations)
+}
+
+// ApplyContext is like Apply but uses ctx for the transaction and every
+// statement in it.
+func (ms *MultiSchema) ApplyContext(ctx context.Context, migrations [][]Migration) (counts []int, err error) {
+	if len(migrations) != len(ms.schemas) {
+		return nil, fmt.Errorf("got %d migration lists for %d schemas", len(migrations), len(ms.schemas))
+	}
+
+	for i, sch := range ms.schemas {
+		err = validate(migrations[i])
+		if err != nil {
+			return nil, err
+		}
+		err = sch.validateNames(migrations[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range migrations[i] {
+			if isNonTransactional(m) {
+				return nil, ErrNonTransactional{Name: m.Name()}
+			}
+		}
+
+		err = sch.ensureInit(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ms.schemas) == 0 {
+		return nil, nil
+	}
+
+	tx, err := beginTx(ctx, ms.db, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = endTx(ctx, tx, err, err == nil)
+		if err != nil {
+			counts = make([]int, len(ms.schemas))
+		}
+	}()
+
+	counts = make([]int, len(ms.schemas))
+	for i, sch := range ms.schemas {
+		err = sch.prepareTx(ctx, tx, false)
+		if err != nil {
+			return nil, err
+		}
+
+		migs := SortMigrations(migrations[i])
+		if !sch.requireNew {
+			migs, _, err = sch.skipAppliedIn(ctx, tx, migs)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = validateAll(tx, migs)
+		if err != nil {
+			return nil, err
+		}
+
+		now := sch.clock.Now()
+		batch := &recordBatch{}
+		for _, m := range migs {
+			err = ctx.Err()
+			if err != nil {
+				return nil, err
+			}
+
+			err = sch.applyOne(ctx, tx, m, now, false, batch, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			counts[i]++
+		}
+
+		err = sch.flushBatch(ctx, tx, batch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return counts, nil
+}
+
+// ApplyAll runs Migrate with migrations on every schema, e.g. on every shard
+// of a sharded database, at most parallelism at a time, or all at once if
+// parallelism is not positive. It returns the number of applied migrations
+// per schema and the errors of the failed schemas, labeled with their index,
+// joined with errors.Join.
+// Every schema is migrated on its own: a failure doesn't stop or undo the
+// others, so some of them may end up migrated and others not.
+func ApplyAll(schemas []*Schema, migrations []Migration, parallelism int) ([]int, error) {
+	return ApplyAllContext(context.Background(), schemas, migrations, parallelism)
+}
+
+// ApplyAllContext is like ApplyAll but uses ctx for the queries and the
+// transactions.
+func ApplyAllContext(ctx context.Context, schemas []*Schema, migrations []Migration, parallelism int) ([]int, error) {
+	if parallelism <= 0 || parallelism > len(schemas) {
+		parallelism = len(schemas)
+	}
+
+	counts := make([]int, len(schemas))
+	errs := make([]error, len(schemas))
+	sem := make(chan struct{}, parallelism)
+
+	var wg sync.WaitGroup
+	for i, sch := range schemas {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, sch *Schema) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			n, err := sch.MigrateContext(ctx, migrations)
+			counts[i] = n
+			if err != nil {
+				errs[i] = fmt.Errorf("schema %d: %w", i, err)
+			}
+		}(i, sch)
+	}
+	wg.Wait()
+
+	return counts, errors.Join(errs...)
+}
@@ -0,0 +1,68 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+// sliceDB is a DB that isn't comparable.
+type sliceDB struct {
+	*sql.DB
+	tags []string
+}
+
+// poolDB is a DB that is a slice, using its first element.
+type poolDB []*sql.DB
+
+func (p poolDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return p[0].BeginTx(ctx, opts)
+}
+
+func (p poolDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p[0].ExecContext(ctx, query, args...)
+}
+
+func (p poolDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p[0].QueryContext(ctx, query, args...)
+}
+
+func (p poolDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p[0].QueryRowContext(ctx, query, args...)
+}
+
+func (p poolDB) Conn(ctx context.Context) (*sql.Conn, error) {
+	return p[0].Conn(ctx)
+}
+
+func TestNewMultiSchema(t *testing.T) {
+	db1, _ := newFakeDB(t)
+	db2, _ := newFakeDB(t)
+	pool := poolDB{db1}
+
+	for _, tt := range []struct {
+		name    string
+		dbs     []DB
+		wantErr error
+	}{
+		{name: "same", dbs: []DB{db1, db1}},
+		{name: "different", dbs: []DB{db1, db2}, wantErr: ErrDifferentDBs},
+		{name: "different types", dbs: []DB{db1, sliceDB{DB: db1}}, wantErr: ErrDifferentDBs},
+		{name: "not comparable", dbs: []DB{sliceDB{DB: db1}, sliceDB{DB: db2}}, wantErr: ErrDifferentDBs},
+		{name: "not comparable alike", dbs: []DB{sliceDB{DB: db1}, sliceDB{DB: db1}}, wantErr: ErrDifferentDBs},
+		{name: "same slice", dbs: []DB{pool, pool}},
+		{name: "different slices", dbs: []DB{pool, poolDB{db1}}, wantErr: ErrDifferentDBs},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var schemas []*Schema
+			for _, db := range tt.dbs {
+				schemas = append(schemas, NewSchema(db, DefaultSchemaName, DefaultMigrationTableName))
+			}
+
+			_, err := NewMultiSchema(schemas...)
+			if err != tt.wantErr {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package migration
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// NameValidator checks a migration name, returning an error if it is invalid.
+type NameValidator func(name string) error
+
+// ErrInvalidName is returned by validators when a migration name is invalid.
+type ErrInvalidName struct {
+	Name   string
+	Reason string
+}
+
+// Error implements the error interface for ErrInvalidName.
+func (err ErrInvalidName) Error() string {
+	return fmt.Sprintf("invalid migration name %q: %s", err.Name, err.Reason)
+}
+
+var _ error = ErrInvalidName{}
+
+var timestampPrefixRE = regexp.MustCompile(`^[0-9]{14}_[a-z0-9]+(_[a-z0-9]+)*$`)
+
+// TimestampPrefixValidator requires names like 20240115123000_add_orders: a
+// 14-digit timestamp, an underscore and a snake_case description. Sorting
+// such names also sorts them chronologically.
+func TimestampPrefixValidator(name string) error {
+	if !timestampPrefixRE.MatchString(name) {
+		return ErrInvalidName{
+			Name:   name,
+			Reason: "want a 14-digit timestamp, an underscore and a snake_case description",
+		}
+	}
+	return nil
+}
+
+var _ NameValidator = TimestampPrefixValidator
+
+// SetNameValidator makes Apply and its variants reject migrations with names
+// that v considers invalid. A nil v disables the check, which is the default.
+func (sch *Schema) SetNameValidator(v NameValidator) {
+	sch.nameValidator = v
+}
+
+// validateNames checks the names of migrations with the name validator.
+func (sch *Schema) validateNames(migrations []Migration) error {
+	if sch.nameValidator == nil {
+		return nil
+	}
+
+	for _, m := range migrations {
+		if err := sch.nameValidator(m.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
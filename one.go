@@ -0,0 +1,160 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+)
+
+// ErrAlreadyApplied is returned by ApplyOne when the migration is already
+// applied and force is false.
+type ErrAlreadyApplied struct {
+	Name string
+}
+
+// Error implements the error interface for ErrAlreadyApplied.
+func (err ErrAlreadyApplied) Error() string {
+	return fmt.Sprintf("migration already applied: %q", err.Name)
+}
+
+var _ error = ErrAlreadyApplied{}
+
+// ApplyOne applies the migration named name alone in a transaction and
+// records it, regardless of order, dependencies and the other migrations,
+// e.g. for a targeted fix. It returns ErrMigrationNotFound if there is no
+// such migration in migrations and ErrAlreadyApplied if it's applied, unless
+// force is true, in which case it's applied again and its record replaced. A
+// NonTransactional migration's record is deleted before it's applied again.
+func (sch *Schema) ApplyOne(migrations []Migration, name string, force bool) error {
+	return sch.ApplyOneContext(context.Background(), migrations, name, force)
+}
+
+// ApplyOneContext is like ApplyOne but uses ctx for the queries and the
+// transaction.
+func (sch *Schema) ApplyOneContext(ctx context.Context, migrations []Migration, name string, force bool) error {
+	m := FindByName(migrations, name)
+	if m == nil {
+		return ErrMigrationNotFound
+	}
+
+	_, err := sch.withLock(ctx, func() (n int, err error) {
+		ctx, end := sch.startBatch(ctx, "migration.apply_batch", false)
+		defer func() {
+			end(n, err)
+		}()
+
+		err = sch.applyOneForced(ctx, m, force)
+		if err != nil {
+			return 0, err
+		}
+		return 1, nil
+	})
+	return err
+}
+
+// applyOneForced applies m alone, deleting its record first if it's applied
+// and force is true.
+func (sch *Schema) applyOneForced(ctx context.Context, m Migration, force bool) (err error) {
+	err = sch.ensureInit(ctx)
+	if err != nil {
+		return err
+	}
+
+	applied, err := sch.isApplied(ctx, sch.db, m.Name())
+	if err != nil {
+		return err
+	}
+	if applied && !force {
+		return ErrAlreadyApplied{Name: m.Name()}
+	}
+
+	now := sch.clock.Now()
+	if nt, ok := m.(NonTransactional); ok {
+		if applied {
+			_, err = sch.db.ExecContext(ctx, sch.queries.delete, m.Name())
+			if err != nil {
+				return failed(m.Name(), OpUnrecord, err)
+			}
+		}
+		return sch.applyNoTx(ctx, nt, now)
+	}
+
+	tx, err := beginTx(ctx, sch.db, sch.txOptions())
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = endTx(ctx, tx, err, err == nil)
+	}()
+
+	err = sch.prepareTx(ctx, tx, false)
+	if err != nil {
+		return err
+	}
+
+	err = validateAll(tx, []Migration{m})
+	if err != nil {
+		return err
+	}
+
+	if applied {
+		_, err = tx.ExecContext(ctx, sch.queries.delete, m.Name())
+		if err != nil {
+			return failed(m.Name(), OpUnrecord, err)
+		}
+	}
+
+	return sch.applyOne(ctx, tx, m, now, false, nil, nil)
+}
+
+// RollbackOne rolls back the migration named name alone and deletes its
+// record, regardless of order, dependencies and the other migrations. It
+// returns ErrMigrationNotFound if there is no such migration in migrations,
+// ErrIrreversible if it's irreversible and ErrNotApplied if it's not applied,
+// unless force is true, in which case it's rolled back anyway, even with
+// SetRequireApplied.
+func (sch *Schema) RollbackOne(migrations []Migration, name string, force bool) error {
+	return sch.RollbackOneContext(context.Background(), migrations, name, force)
+}
+
+// RollbackOneContext is like RollbackOne but uses ctx for the queries and the
+// transaction.
+func (sch *Schema) RollbackOneContext(ctx context.Context, migrations []Migration, name string, force bool) error {
+	m := FindByName(migrations, name)
+	if m == nil {
+		return ErrMigrationNotFound
+	}
+	if isIrreversible(m) {
+		return ErrIrreversible{Name: m.Name()}
+	}
+
+	_, err := sch.withLock(ctx, func() (n int, err error) {
+		ctx, end := sch.startBatch(ctx, "migration.rollback_batch", false)
+		defer func() {
+			end(n, err)
+		}()
+
+		err = sch.ensureInit(ctx)
+		if err != nil {
+			return 0, err
+		}
+
+		applied, err := sch.isApplied(ctx, sch.db, m.Name())
+		if err != nil {
+			return 0, err
+		}
+		if !applied && !force {
+			return 0, ErrNotApplied{Name: m.Name()}
+		}
+
+		if nt, ok := m.(NonTransactional); ok {
+			err = sch.rollbackNoTx(ctx, nt, true)
+			if err != nil {
+				return 0, err
+			}
+			return 1, nil
+		}
+		return sch.rollbackTx(ctx, []Migration{m}, false, true)
+	})
+	return err
+}
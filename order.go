@@ -0,0 +1,178 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// OrderColumn is a migrations table column to sort applied migrations by.
+type OrderColumn string
+
+// Order columns.
+const (
+	OrderByName      OrderColumn = "name"
+	OrderByAppliedAt OrderColumn = "applied_at"
+)
+
+// ErrInvalidOrderColumn is returned by SetOrderBy for unknown columns.
+type ErrInvalidOrderColumn struct {
+	Column OrderColumn
+}
+
+// Error implements the error interface for ErrInvalidOrderColumn.
+func (err ErrInvalidOrderColumn) Error() string {
+	return fmt.Sprintf("invalid order column: %q", string(err.Column))
+}
+
+var _ error = ErrInvalidOrderColumn{}
+
+// SetOrderBy sets the order FindUnrolled returns applied migrations in.
+// Ordering by name honors Ordered migrations, ordering by applied_at follows
+// the apply order recorded in the id column, falling back to applied_at and
+// name for records made before Init added it. The default is by name
+// descending, the reverse of the apply order. FindUnapplied is not affected
+// since unapplied migrations have no applied_at, and neither are Reset and
+// RollbackN, which always roll back in the reverse of the apply order.
+//
+// Only OrderByName and OrderByAppliedAt are accepted. They refer to the
+// columns configured with SetColumns.
+func (sch *Schema) SetOrderBy(column OrderColumn, desc bool) error {
+	if column != OrderByName && column != OrderByAppliedAt {
+		return ErrInvalidOrderColumn{Column: column}
+	}
+
+	sch.orderColumn = column
+	sch.orderDesc = desc
+	return nil
+}
+
+// orderByClause returns the ORDER BY clause of the configured order.
+func (sch *Schema) orderByClause() string {
+	if sch.orderColumn == OrderByAppliedAt {
+		return sch.applyOrderClause(sch.orderDesc)
+	}
+
+	dir := ``
+	if sch.orderDesc {
+		dir = ` DESC`
+	}
+	return `ORDER BY ` + sch.col(sch.cols.Name) + dir
+}
+
+// applyOrderClause returns the ORDER BY clause of the order migrations were
+// applied in: by id, with records lacking it first, then by applied_at and
+// by name.
+func (sch *Schema) applyOrderClause(desc bool) string {
+	dir := ``
+	if desc {
+		dir = ` DESC`
+	}
+	id := sch.col(idColumn)
+	return `ORDER BY CASE WHEN ` + id + ` IS NULL THEN 0 ELSE 1 END` + dir + `, ` +
+		id + dir + `, ` + sch.col(sch.cols.AppliedAt) + dir + `, ` + sch.col(sch.cols.Name) + dir
+}
+
+// queryNames returns the names in the migrations table selected with clause,
+// which filters, groups or orders them, at most limit of them unless limit is
+// zero.
+func (sch *Schema) queryNames(ctx context.Context, clause string, limit int) (res []string, err error) {
+	q := sch.queries.names + ` ` + clause
+	var args []interface{}
+	if limit > 0 {
+		q += ` LIMIT ` + sch.dialect.Placeholder(1)
+		args = append(args, limit)
+	}
+
+	rows, err := sch.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		closeErr := rows.Close()
+		if closeErr != nil {
+			if err != nil {
+				err = ErrorPair{Err1: err, Err2: closeErr}
+			} else {
+				err = closeErr
+			}
+		}
+	}()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		res = append(res, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ErrOutOfOrder is returned by CheckOrder when unapplied migrations sort before
+// the last applied one.
+type ErrOutOfOrder struct {
+	Names []string
+	Last  string
+}
+
+// Error implements the error interface for ErrOutOfOrder.
+func (err ErrOutOfOrder) Error() string {
+	return fmt.Sprintf("migrations %s are unapplied but sort before applied migration %q",
+		strings.Join(err.Names, ", "), err.Last)
+}
+
+var _ error = ErrOutOfOrder{}
+
+// CheckOrder returns ErrOutOfOrder if some unapplied migrations sort before
+// the last applied one, e.g. a branch merged with an older timestamp than a
+// migration already deployed. Apply would still apply them, after the later
+// ones; CheckOrder is for teams that want to rule that out. It only reads
+// from the database.
+func (sch *Schema) CheckOrder(migrations []Migration) error {
+	return sch.CheckOrderContext(context.Background(), migrations)
+}
+
+// CheckOrderContext is like CheckOrder but uses ctx for the queries.
+func (sch *Schema) CheckOrderContext(ctx context.Context, migrations []Migration) error {
+	set, err := NewMigrationSet(migrations)
+	if err != nil {
+		return err
+	}
+
+	exists, err := sch.tableExists(ctx)
+	if err != nil || !exists {
+		return err
+	}
+
+	applied, _, err := sch.queryAppliedIn(ctx, set, false)
+	if err != nil {
+		return err
+	}
+
+	last := -1
+	for i, m := range set.migrations {
+		if applied[m.Name()] {
+			last = i
+		}
+	}
+
+	var names []string
+	for _, m := range set.migrations[:last+1] {
+		if !applied[m.Name()] {
+			names = append(names, m.Name())
+		}
+	}
+
+	if len(names) > 0 {
+		return ErrOutOfOrder{Names: names, Last: set.migrations[last].Name()}
+	}
+	return nil
+}
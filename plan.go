@@ -0,0 +1,123 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Plan describes what Apply would do with unapplied migrations.
+type Plan struct {
+	// Pending are the unapplied migrations in the order they would be applied.
+	Pending []Migration
+	// TableExists reports whether the migrations table exists.
+	TableExists bool
+}
+
+// String returns a human-readable summary of the plan.
+func (p *Plan) String() string {
+	var b strings.Builder
+	if !p.TableExists {
+		b.WriteString("migrations table does not exist yet\n")
+	}
+
+	switch len(p.Pending) {
+	case 0:
+		b.WriteString("no migrations will run\n")
+	case 1:
+		b.WriteString("1 migration will run:\n")
+	default:
+		fmt.Fprintf(&b, "%d migrations will run:\n", len(p.Pending))
+	}
+
+	for i, m := range p.Pending {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, m.Name())
+	}
+
+	return b.String()
+}
+
+// Plan returns the plan of applying migrations. It only reads from the
+// database.
+func (sch *Schema) Plan(migrations []Migration) (*Plan, error) {
+	return sch.PlanContext(context.Background(), migrations)
+}
+
+// PlanContext is like Plan but uses ctx for the queries.
+func (sch *Schema) PlanContext(ctx context.Context, migrations []Migration) (*Plan, error) {
+	exists, err := sch.tableExists(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		if _, err := indexByName(migrations); err != nil {
+			return nil, err
+		}
+
+		return &Plan{Pending: SortMigrations(migrations)}, nil
+	}
+
+	pending, err := sch.FindUnappliedContext(ctx, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Plan{Pending: pending, TableExists: true}, nil
+}
+
+// PlanSQL returns the SQL that applying migrations would run by name of every
+// pending SQLer, passed through the rewriter of SetSQLRewriter if set. Other
+// pending migrations can't show their SQL and are left out. It only reads
+// from the database.
+func (sch *Schema) PlanSQL(migrations []Migration) (map[string]string, error) {
+	return sch.PlanSQLContext(context.Background(), migrations)
+}
+
+// PlanSQLContext is like PlanSQL but uses ctx for the queries.
+func (sch *Schema) PlanSQLContext(ctx context.Context, migrations []Migration) (map[string]string, error) {
+	p, err := sch.PlanContext(ctx, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]string{}
+	for _, m := range p.Pending {
+		q, ok, err := sch.rewrittenSQL(m)
+		if err != nil {
+			return nil, failed(m.Name(), OpApply, err)
+		}
+		if ok {
+			res[m.Name()] = q
+		} else if s, ok := m.(SQLer); ok {
+			res[m.Name()] = s.UpSQL()
+		}
+	}
+
+	return res, nil
+}
+
+// Exists reports whether the migrations table exists, e.g. to tell a new
+// database apart before Init.
+func (sch *Schema) Exists() (bool, error) {
+	return sch.ExistsContext(context.Background())
+}
+
+// ExistsContext is like Exists but uses ctx for the query.
+func (sch *Schema) ExistsContext(ctx context.Context) (bool, error) {
+	return sch.tableExists(ctx)
+}
+
+// tableExists reports whether the migrations table exists.
+func (sch *Schema) tableExists(ctx context.Context) (bool, error) {
+	return sch.tableExistsIn(ctx, sch.db)
+}
+
+// tableExistsIn is like tableExists but runs the query with db.
+func (sch *Schema) tableExistsIn(ctx context.Context, db queryRower) (bool, error) {
+	q, args := sch.dialect.TableExists(sch.migTableSchema, sch.migTableName)
+
+	var exists bool
+	err := db.QueryRowContext(ctx, q, args...).Scan(&exists)
+	return exists, err
+}
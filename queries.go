@@ -0,0 +1,44 @@
+package migration
+
+// queries are the statements on the migrations table that don't vary between
+// calls. They're built whenever the table, the dialect or the columns change
+// rather than on every call.
+type queries struct {
+	insert    string // records an applied migration
+	delete    string // deletes a migration record by name
+	count     string // counts records by name
+	names     string // selects every name
+	list      string // selects every record in the apply order
+	one       string // selects a record like list by name
+	between   string // selects records like list applied in a time range
+	checksums string // selects every name and checksum ordered by name
+	columns   string // selects no rows, only the columns
+	maxID     string // selects the greatest id or 0
+}
+
+// buildQueries rebuilds the queries of sch.
+func (sch *Schema) buildQueries() {
+	t := sch.table()
+	name, appliedAt := sch.col(sch.cols.Name), sch.col(sch.cols.AppliedAt)
+	p1 := sch.dialect.Placeholder(1)
+	p2 := sch.dialect.Placeholder(2)
+
+	// The list, one and between queries select the columns scanApplied
+	// expects.
+	selectList := `SELECT ` + name + `, ` + appliedAt + `, ` + sch.col(durationColumn) + `, ` +
+		sch.col(sourceColumn) + ` FROM ` + t
+
+	sch.queries = queries{
+		insert: sch.insertRowsQuery(1),
+		delete: `DELETE FROM ` + t + ` WHERE ` + name + ` = ` + p1,
+		count:  `SELECT COUNT(*) FROM ` + t + ` WHERE ` + name + ` = ` + p1,
+		names:  `SELECT ` + name + ` FROM ` + t,
+		list:   selectList + ` ` + sch.applyOrderClause(false),
+		one:    selectList + ` WHERE ` + name + ` = ` + p1,
+		between: selectList + ` WHERE ` + appliedAt + ` BETWEEN ` + p1 + ` AND ` + p2 + ` ` +
+			sch.applyOrderClause(false),
+		checksums: `SELECT ` + name + `, ` + sch.col(checksumColumn) + ` FROM ` + t + ` ORDER BY ` + name,
+		columns:   `SELECT * FROM ` + t + ` WHERE 1 = 0`,
+		maxID:     `SELECT COALESCE(MAX(` + sch.col(idColumn) + `), 0) FROM ` + t,
+	}
+}
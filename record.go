@@ -0,0 +1,179 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// idColumn is the column of the migrations table holding the sequence number
+// of a record, which tells the order migrations were applied in even within
+// a batch sharing applied_at. Records made before the column was added have
+// no id.
+const idColumn = "id"
+
+// checksumColumn is the column of the migrations table holding the checksum
+// of a Checksummer migration.
+const checksumColumn = "checksum"
+
+// durationColumn is the column of the migrations table holding how long a
+// migration took to apply, in milliseconds.
+const durationColumn = "duration_ms"
+
+// sourceColumn is the column of the migrations table holding the source set
+// by SetSource.
+const sourceColumn = "source"
+
+// recordColumns is the number of columns inserted per record.
+const recordColumns = 6
+
+// batchColumns is the number of columns per record kept in recordBatch: all
+// but the id and the source, which flushBatch adds.
+const batchColumns = recordColumns - 2
+
+// maxBatchRows is the most records inserted by a single statement. It keeps
+// the number of query arguments within the limits of supported databases,
+// the lowest being 999 in older SQLite versions.
+const maxBatchRows = 999 / recordColumns
+
+type execQueryRower interface {
+	queryRower
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// recordBatch accumulates the records of applied migrations, so that they are
+// inserted with a statement per maxBatchRows migrations rather than one per
+// migration, saving a round trip for each.
+type recordBatch struct {
+	names []string
+	args  []interface{}
+}
+
+// add adds the record of the migration named name.
+func (b *recordBatch) add(name string, appliedAt time.Time, checksum, durationMS interface{}) {
+	b.names = append(b.names, name)
+	b.args = append(b.args, name, appliedAt, checksum, durationMS)
+}
+
+// record inserts the record of the migration named name.
+func (sch *Schema) record(ctx context.Context, q execQueryRower, name string, appliedAt time.Time, checksum, durationMS interface{}) error {
+	batch := &recordBatch{}
+	batch.add(name, appliedAt, checksum, durationMS)
+	return sch.flushBatch(ctx, q, batch)
+}
+
+// recordTx records the migration named name like record, in a transaction of
+// its own that takes the transaction lock.
+func (sch *Schema) recordTx(ctx context.Context, name string, appliedAt time.Time, checksum, durationMS interface{}) (err error) {
+	tx, err := beginTx(ctx, sch.db, sch.txOptions())
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = endTx(ctx, tx, err, err == nil)
+	}()
+
+	err = sch.prepareTx(ctx, tx, false)
+	if err != nil {
+		return err
+	}
+
+	return sch.record(ctx, tx, name, appliedAt, checksum, durationMS)
+}
+
+// flushBatch inserts the records accumulated in batch, numbering them after
+// the greatest id in the table, and empties it. Every path recording
+// migrations does it in a transaction holding the transaction lock, so
+// concurrent flushes don't read the same greatest id. Where there is no such
+// lock, the id column is unique, so a concurrent flush numbering its records
+// alike fails instead of recording them twice.
+func (sch *Schema) flushBatch(ctx context.Context, q execQueryRower, batch *recordBatch) error {
+	if len(batch.names) == 0 {
+		return nil
+	}
+
+	var id int64
+	err := q.QueryRowContext(ctx, sch.queries.maxID).Scan(&id)
+	if err != nil {
+		return recordFailed(batch.names, err)
+	}
+
+	for len(batch.names) > 0 {
+		k := len(batch.names)
+		if k > maxBatchRows {
+			k = maxBatchRows
+		}
+
+		args := make([]interface{}, 0, recordColumns*k)
+		for i := 0; i < k; i++ {
+			id++
+			args = append(args, id)
+			args = append(args, batch.args[batchColumns*i:batchColumns*(i+1)]...)
+			args = append(args, sch.sourceArg())
+		}
+
+		query := sch.queries.insert
+		if k > 1 {
+			query = sch.insertRowsQuery(k)
+		}
+
+		_, err = q.ExecContext(ctx, query, args...)
+		if err != nil {
+			return recordFailed(batch.names[:k], err)
+		}
+
+		batch.names, batch.args = batch.names[k:], batch.args[batchColumns*k:]
+	}
+	return nil
+}
+
+// SetSource sets the source recorded along with every migration applied
+// afterwards, e.g. a deploy id or a user name, as an audit trail that
+// ListApplied returns. Init adds the source column to existing tables. An
+// empty source, the default, is recorded as NULL.
+func (sch *Schema) SetSource(source string) {
+	sch.source = source
+}
+
+// sourceArg returns the value of the source column of new records.
+func (sch *Schema) sourceArg() interface{} {
+	if sch.source == "" {
+		return nil
+	}
+	return sch.source
+}
+
+// recordFailed wraps err of recording the migrations named names in
+// ErrMigrationFailed of the first one, mentioning the last one of a batch.
+func recordFailed(names []string, err error) error {
+	if len(names) > 1 {
+		err = fmt.Errorf("in a batch up to %q: %w", names[len(names)-1], err)
+	}
+	return failed(names[0], OpRecord, err)
+}
+
+// insertRowsQuery returns the query recording n applied migrations.
+func (sch *Schema) insertRowsQuery(n int) string {
+	var b strings.Builder
+	b.WriteString(`INSERT INTO ` + sch.table() + ` (` + sch.col(idColumn) + `, ` + sch.col(sch.cols.Name) + `, ` +
+		sch.col(sch.cols.AppliedAt) + `, ` + sch.col(checksumColumn) + `, ` + sch.col(durationColumn) + `, ` +
+		sch.col(sourceColumn) + `) VALUES `)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(`, `)
+		}
+
+		b.WriteString(`(`)
+		for j := 1; j <= recordColumns; j++ {
+			if j > 1 {
+				b.WriteString(`, `)
+			}
+			b.WriteString(sch.dialect.Placeholder(recordColumns*i + j))
+		}
+		b.WriteString(`)`)
+	}
+	return b.String()
+}
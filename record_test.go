@@ -0,0 +1,182 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// BenchmarkRecord compares recording 100 migrations with a statement each to
+// flushing them in a batch, with every statement taking a round trip of 100µs.
+func BenchmarkRecord(b *testing.B) {
+	const n = 100
+	for _, bench := range []struct {
+		name    string
+		batched bool
+	}{
+		{name: "unbatched"},
+		{name: "batched", batched: true},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			ctx := context.Background()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				sch, fdb := newTestSchema(b)
+				fdb.delay = 100 * time.Microsecond
+				now := time.Now()
+				b.StartTimer()
+
+				batch := &recordBatch{}
+				for j := 0; j < n; j++ {
+					name := fmt.Sprint(j)
+					if !bench.batched {
+						if err := sch.record(ctx, sch.db, name, now, nil, nil); err != nil {
+							b.Fatal(err)
+						}
+						continue
+					}
+					batch.add(name, now, nil, nil)
+				}
+				if err := sch.flushBatch(ctx, sch.db, batch); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// noTxMigration is a NonTransactional testMigration.
+type noTxMigration struct {
+	Struct
+}
+
+func (m noTxMigration) ApplyNoTx(ctx context.Context, db DB) error {
+	_, err := db.ExecContext(ctx, "APPLY "+m.Name())
+	return err
+}
+
+func (m noTxMigration) RollbackNoTx(ctx context.Context, db DB) error {
+	_, err := db.ExecContext(ctx, "UNDO "+m.Name())
+	return err
+}
+
+func TestRecordLocks(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		record func(sch *Schema) error
+	}{
+		{
+			name: "MarkApplied",
+			record: func(sch *Schema) error {
+				return sch.MarkApplied("1")
+			},
+		},
+		{
+			name: "NonTransactional",
+			record: func(sch *Schema) error {
+				_, err := sch.Apply([]Migration{noTxMigration{testMigration("1")}})
+				return err
+			},
+		},
+		{
+			name: "ApplyTx",
+			record: func(sch *Schema) error {
+				tx, err := sch.db.BeginTx(context.Background(), nil)
+				if err != nil {
+					return err
+				}
+				_, err = sch.ApplyTx(tx, testMigrations("1"))
+				if err != nil {
+					tx.Rollback()
+					return err
+				}
+				return tx.Commit()
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sch, fdb := newTestSchema(t)
+			var locked bool
+			fdb.setHook(func(q string) error {
+				if strings.HasPrefix(q, "SELECT pg_advisory_xact_lock") {
+					locked = true
+				}
+				if strings.HasPrefix(q, "INSERT") && !locked {
+					return errors.New("recorded without the lock")
+				}
+				return nil
+			})
+
+			if err := tt.record(sch); err != nil {
+				t.Fatal(err)
+			}
+			if got := fdb.names(testTable); !reflect.DeepEqual(got, []string{"1"}) {
+				t.Errorf("recorded %q, want [1]", got)
+			}
+		})
+	}
+}
+
+func TestRecordUniqueID(t *testing.T) {
+	sch, _ := newTestSchema(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	// Two flushes that read the same greatest id, as concurrent ones without
+	// the lock may, number their records alike.
+	tx1, err := sch.db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx1.Rollback()
+	if err := sch.record(ctx, tx1, "1", now, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := sch.record(ctx, sch.db, "2", now, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	err = tx1.Commit()
+	var fe fakeError
+	if !errors.As(err, &fe) || fe.SQLState() != "23505" {
+		t.Errorf("got %v committing a duplicate id, want a unique violation", err)
+	}
+}
+
+func TestRecordFailed(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		savepoints bool
+	}{
+		{name: "batch"},
+		{name: "savepoints", savepoints: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sch, fdb := newTestSchema(t)
+			sch.SetSavepoints(tt.savepoints)
+			errInsert := errors.New("insert failed")
+			fdb.setHook(func(q string) error {
+				if strings.HasPrefix(q, "INSERT") {
+					return errInsert
+				}
+				return nil
+			})
+
+			_, err := sch.Apply(testMigrations("1", "2", "3"))
+			var failErr ErrMigrationFailed
+			if !errors.As(err, &failErr) || failErr.Op != OpRecord || failErr.Name != "1" {
+				t.Fatalf("got %v, want ErrMigrationFailed recording 1", err)
+			}
+			if !errors.Is(err, errInsert) {
+				t.Errorf("got %v, want it to wrap the INSERT error", err)
+			}
+			if got := fdb.names(testTable); len(got) > 0 {
+				t.Errorf("recorded %q, want nothing", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package migration
+
+import "sync"
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]Migration{}
+)
+
+// Register adds m to the global registry, typically from an init function of
+// the package defining it. Like sql.Register, it panics if m is nil, has an
+// empty name or has the name of an already registered migration, since that
+// is a programming error.
+func Register(m Migration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if m == nil {
+		panic("migration: Register migration is nil")
+	}
+	if m.Name() == "" {
+		panic("migration: Register " + ErrEmptyName.Error())
+	}
+	if _, dup := registry[m.Name()]; dup {
+		panic("migration: Register called twice for " + m.Name())
+	}
+	registry[m.Name()] = m
+}
+
+// Registered returns the migrations added with Register, sorted like
+// SortMigrations, e.g. to pass them to Migrate.
+func Registered() []Migration {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	res := make([]Migration, 0, len(registry))
+	for _, m := range registry {
+		res = append(res, m)
+	}
+	return SortMigrations(res)
+}
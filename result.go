@@ -0,0 +1,77 @@
+package migration
+
+import (
+	"context"
+	"time"
+)
+
+// Result describes a run of ApplyResult.
+type Result struct {
+	// AppliedNames are the names of the applied migrations in order.
+	AppliedNames []string
+	// Skipped are the names of the migrations that were not applied, either
+	// because they had been applied before or because of an error.
+	Skipped []string
+	// Retries is the number of times the batch was retried.
+	Retries int
+	// RowsAffected are the numbers of rows affected by the applied
+	// RowsMigration migrations by name.
+	RowsAffected map[string]int64
+	// Pending is the number of unapplied migrations the run was to apply.
+	Pending int
+	// Executed is the number of migrations that ran without an error. On
+	// failure it includes the ones rolled back with the transaction, so
+	// Executed+1 of Pending is the position of the failed migration, while
+	// AppliedNames lists only the committed ones.
+	Executed int
+	// Failed is the name of the migration that failed to validate or apply,
+	// if any.
+	Failed string
+
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// SetAfterCommit sets a hook called with the result of every successful
+// Apply, ApplyResult and Migrate (and their variants) that applied at least
+// one migration, after the transaction is committed and the lock released. It
+// isn't called for dry runs or failed batches. The migrations are applied by
+// then, so the hook can't fail them; it should handle its errors itself.
+func (sch *Schema) SetAfterCommit(hook func(result *Result)) {
+	sch.afterCommit = hook
+}
+
+// notifyCommit calls the after commit hook with res if it's set and res
+// applied some migrations.
+func (sch *Schema) notifyCommit(res *Result) {
+	if sch.afterCommit != nil && len(res.AppliedNames) > 0 {
+		sch.afterCommit(res)
+	}
+}
+
+// ApplyResult is like Apply but returns a Result describing the run. The
+// result is returned even if there is an error.
+func (sch *Schema) ApplyResult(migrations []Migration) (*Result, error) {
+	return sch.ApplyResultContext(context.Background(), migrations)
+}
+
+// ApplyResultContext is like ApplyResult but uses ctx for the transaction and
+// every statement in it.
+func (sch *Schema) ApplyResultContext(ctx context.Context, migrations []Migration) (*Result, error) {
+	res := &Result{StartedAt: sch.clock.Now()}
+
+	_, err := sch.withLock(ctx, func() (int, error) {
+		n, retries, err := sch.withRetry(ctx, func() (int, error) {
+			return sch.apply(ctx, migrations, false, res)
+		})
+		res.Retries = retries
+		return n, err
+	})
+
+	res.FinishedAt = sch.clock.Now()
+	if err == nil {
+		sch.notifyCommit(res)
+	}
+
+	return res, err
+}
@@ -0,0 +1,76 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy configures retrying Apply on transient errors.
+type RetryPolicy struct {
+	// SQLStates are the SQLSTATE codes to retry on, e.g. "40001" for
+	// serialization_failure.
+	SQLStates []string
+	// MaxAttempts is the maximum number of attempts including the first one.
+	MaxAttempts int
+	// Backoff is the delay before the first retry. It doubles with every
+	// retry.
+	Backoff time.Duration
+}
+
+// SetRetry makes Apply and its variants re-run the whole batch in a new
+// transaction when it fails with one of the SQLSTATE codes of p. Batches are
+// not retried once some of their migrations have been committed. The error
+// must have a SQLState() string method, as the errors of lib/pq and pgx do.
+// Retrying is disabled by default.
+func (sch *Schema) SetRetry(p RetryPolicy) {
+	sch.retryPolicy = p
+}
+
+// sqlState returns the SQLSTATE code of err or an empty string if there is
+// none.
+func sqlState(err error) string {
+	var se interface{ SQLState() string }
+	if errors.As(err, &se) {
+		return se.SQLState()
+	}
+	return ""
+}
+
+// retryable reports whether err should be retried according to the policy.
+func (sch *Schema) retryable(err error) bool {
+	state := sqlState(err)
+	if state == "" {
+		return false
+	}
+
+	for _, s := range sch.retryPolicy.SQLStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetry calls f retrying it according to the retry policy. It returns
+// the number of retries along with the results of the last call.
+func (sch *Schema) withRetry(ctx context.Context, f func() (int, error)) (n, retries int, err error) {
+	backoff := sch.retryPolicy.Backoff
+	for {
+		n, err = f()
+		if err == nil || n > 0 || retries+1 >= sch.retryPolicy.MaxAttempts || !sch.retryable(err) {
+			return n, retries, err
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return n, retries, ctx.Err()
+		}
+
+		backoff *= 2
+		retries++
+	}
+}
@@ -0,0 +1,110 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	type entry func(sch *Schema, migs []Migration) (*Result, error)
+	applyResult := func(sch *Schema, migs []Migration) (*Result, error) {
+		return sch.ApplyResult(migs)
+	}
+	migrate := func(sch *Schema, migs []Migration) (*Result, error) {
+		var res *Result
+		sch.SetAfterCommit(func(r *Result) {
+			res = r
+		})
+		_, err := sch.MigrateContext(context.Background(), migs)
+		return res, err
+	}
+
+	for _, tt := range []struct {
+		name         string
+		state        string
+		failures     int
+		wantAttempts int
+		wantErr      bool
+		wantApplied  []string
+	}{
+		{
+			name:         "no failures",
+			state:        "40001",
+			wantAttempts: 1,
+			wantApplied:  []string{"1", "2"},
+		},
+		{
+			name:         "retried",
+			state:        "40001",
+			failures:     2,
+			wantAttempts: 3,
+			wantApplied:  []string{"1", "2"},
+		},
+		{
+			name:         "out of attempts",
+			state:        "40001",
+			failures:     3,
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+		{
+			name:         "not retryable",
+			state:        "23505",
+			failures:     1,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	} {
+		for _, e := range []struct {
+			name string
+			f    entry
+		}{
+			{name: "ApplyResult", f: applyResult},
+			{name: "Migrate", f: migrate},
+		} {
+			t.Run(tt.name+"/"+e.name, func(t *testing.T) {
+				sch, db := newTestSchema(t)
+				sch.SetRetry(RetryPolicy{
+					SQLStates:   []string{"40001", "40P01"},
+					MaxAttempts: 3,
+					Backoff:     time.Millisecond,
+				})
+
+				attempts := 0
+				db.setHook(func(q string) error {
+					if q != "APPLY 2" {
+						return nil
+					}
+					attempts++
+					if attempts <= tt.failures {
+						return fakeError{state: tt.state, msg: "failure " + tt.state}
+					}
+					return nil
+				})
+
+				res, err := e.f(sch, testMigrations("1", "2"))
+				if tt.wantErr {
+					var fe fakeError
+					if !errors.As(err, &fe) || fe.SQLState() != tt.state {
+						t.Fatalf("got %v, want the SQLSTATE %s failure", err, tt.state)
+					}
+				} else if err != nil {
+					t.Fatal(err)
+				}
+
+				if attempts != tt.wantAttempts {
+					t.Errorf("made %d attempts, want %d", attempts, tt.wantAttempts)
+				}
+				if !tt.wantErr && res.Retries != tt.wantAttempts-1 {
+					t.Errorf("got %d retries, want %d", res.Retries, tt.wantAttempts-1)
+				}
+				if got := db.names(testTable); !reflect.DeepEqual(got, tt.wantApplied) {
+					t.Errorf("applied %q, want %q", got, tt.wantApplied)
+				}
+			})
+		}
+	}
+}
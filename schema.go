@@ -1,10 +1,13 @@
 package migration
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,18 +19,151 @@ const DefaultSchemaName = "public"
 
 // Schema is the single database's schema representation.
 type Schema struct {
-	db           *sql.DB
-	schemaName   string
-	migTableName string
+	config
+
+	lockMu   sync.Mutex
+	lockConn *sql.Conn
+	locked   int32 // accessed atomically, 1 while Lock is held
+}
+
+// config is the part of Schema copied by WithTable and WithSchema.
+type config struct {
+	db             DB
+	schemaName     string
+	migTableSchema string
+	migTableName   string
+	dialect        Dialect
+	cols           ColumnConfig
+
+	logger       Logger
+	tracer       Tracer
+	clock        Clock
+	beforeCommit func(tx *sql.Tx) error
+	afterCommit  func(result *Result)
+	beforeEach   func(name string, isDry bool) error
+	afterEach    func(name string, isDry bool) error
+
+	autoLock       bool
+	autoInit       bool
+	savepoints     bool
+	strict         bool
+	forceOrphans   bool
+	requireApplied bool
+	requireNew     bool
+	noTxLock       bool
+	searchPath     bool
+	nameValidator  NameValidator
+	retryPolicy    RetryPolicy
+	migTimeout     time.Duration
+	isolation      sql.IsolationLevel
+	ignoreStates   []string
+	orderColumn    OrderColumn
+	orderDesc      bool
+	sqlRewriter    func(name, sql string) (string, error)
+	source         string
+
+	queries queries
+}
+
+// NewSchema returns a new Schema. db is usually a *sql.DB.
+func NewSchema(db DB, schemaName, migTableName string) *Schema {
+	sch := &Schema{config: config{
+		db:             db,
+		schemaName:     schemaName,
+		migTableSchema: schemaName,
+		migTableName:   migTableName,
+		logger:         nopLogger{},
+		dialect:        PostgresDialect{},
+		cols:           DefaultColumnConfig,
+		clock:          realClock{},
+		orderColumn:    OrderByName,
+		orderDesc:      true,
+	}}
+	sch.buildQueries()
+	return sch
+}
+
+// WithTable returns a copy of sch using the migrations table named name. The
+// copy shares the DB and every setting of sch but not its lock: it's keyed on
+// the new table and starts unlocked.
+func (sch *Schema) WithTable(name string) *Schema {
+	c := &Schema{config: sch.config}
+	c.migTableName = name
+	c.buildQueries()
+	return c
 }
 
-// NewSchema returns a new Schema.
-func NewSchema(db *sql.DB, schemaName, migTableName string) *Schema {
-	return &Schema{
-		db:           db,
-		schemaName:   schemaName,
-		migTableName: migTableName,
+// WithSchema is like WithTable but returns a copy using the schema named name.
+// The migrations table moves to it too unless it was put elsewhere with
+// SetTableSchema.
+func (sch *Schema) WithSchema(name string) *Schema {
+	c := &Schema{config: sch.config}
+	if c.migTableSchema == c.schemaName {
+		c.migTableSchema = name
 	}
+	c.schemaName = name
+	c.buildQueries()
+	return c
+}
+
+// ErrInvalidIdentifier is returned by NewSchemaStrict when a schema or table
+// name is not a plain identifier.
+type ErrInvalidIdentifier struct {
+	Name string
+}
+
+// Error implements the error interface for ErrInvalidIdentifier.
+func (err ErrInvalidIdentifier) Error() string {
+	return fmt.Sprintf("invalid identifier: %q", err.Name)
+}
+
+var _ error = ErrInvalidIdentifier{}
+
+// NewSchemaStrict is like NewSchema but returns ErrInvalidIdentifier unless
+// schemaName and migTableName consist only of ASCII letters, digits and
+// underscores. Identifiers can't be passed as query arguments, so it's the
+// safe choice for names that come from configuration.
+func NewSchemaStrict(db DB, schemaName, migTableName string) (*Schema, error) {
+	for _, name := range []string{schemaName, migTableName} {
+		if !isPlainIdent(name) {
+			return nil, ErrInvalidIdentifier{Name: name}
+		}
+	}
+	return NewSchema(db, schemaName, migTableName), nil
+}
+
+// isPlainIdent reports whether s is a non-empty string of [A-Za-z0-9_].
+func isPlainIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// SetDialect sets the dialect of the database. The default is
+// PostgresDialect.
+func (sch *Schema) SetDialect(d Dialect) {
+	sch.dialect = d
+	sch.buildQueries()
+}
+
+// SetTableSchema makes the migrations table live in schema rather than in the
+// schema passed to NewSchema, which remains the one SetSearchPath sets. Init
+// creates schema if it doesn't exist. It's meant for keeping bookkeeping
+// apart from the data, since migrations operate wherever their SQL says.
+func (sch *Schema) SetTableSchema(schema string) {
+	sch.migTableSchema = schema
+	sch.buildQueries()
+}
+
+// table returns the quoted name of the migrations table.
+func (sch *Schema) table() string {
+	return sch.dialect.Table(sch.migTableSchema, sch.migTableName)
 }
 
 // ErrorPair is a pair of errors.
@@ -40,222 +176,1255 @@ func (err ErrorPair) Error() string {
 	return fmt.Sprintf("err1: %q, err2: %q", err.Err1, err.Err2)
 }
 
-// Apply applies all migrations in a single transaction. It returns the number
-// of applied migrations and error if any.
+// Unwrap returns both errors, so errors.Is and errors.As check each of them.
+func (err ErrorPair) Unwrap() []error {
+	return []error{err.Err1, err.Err2}
+}
+
+// ErrBeginTx is returned when a transaction can't be started.
+type ErrBeginTx struct {
+	Err error
+}
+
+// Error implements the error interface for ErrBeginTx.
+func (err ErrBeginTx) Error() string {
+	return fmt.Sprintf("begin transaction: %v", err.Err)
+}
+
+// Unwrap returns the underlying error.
+func (err ErrBeginTx) Unwrap() error {
+	return err.Err
+}
+
+var _ error = ErrBeginTx{}
+
+// ErrCommit is returned when a transaction can't be committed.
+type ErrCommit struct {
+	Err error
+}
+
+// Error implements the error interface for ErrCommit.
+func (err ErrCommit) Error() string {
+	return fmt.Sprintf("commit transaction: %v", err.Err)
+}
+
+// Unwrap returns the underlying error.
+func (err ErrCommit) Unwrap() error {
+	return err.Err
+}
+
+var _ error = ErrCommit{}
+
+// beginTx starts a transaction in db, wrapping the error in ErrBeginTx.
+func beginTx(ctx context.Context, db DB, opts *sql.TxOptions) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, ErrBeginTx{Err: err}
+	}
+	return tx, nil
+}
+
+// endTx commits tx if commit is true and rolls it back otherwise, returning
+// err combined with the error of doing so. If ctx is done, ctx.Err() is
+// returned instead of whatever the driver reported. Commit errors are wrapped
+// in ErrCommit.
+func endTx(ctx context.Context, tx *sql.Tx, err error, commit bool) error {
+	if commit {
+		cErr := tx.Commit()
+		if cErr != nil {
+			cErr = ErrCommit{Err: cErr}
+		}
+		if cErr != nil && ctx.Err() != nil {
+			cErr = ctx.Err()
+		}
+		if cErr != nil && err != nil {
+			return ErrorPair{Err1: err, Err2: cErr}
+		}
+		if cErr != nil {
+			return cErr
+		}
+		return err
+	}
+
+	rbErr := tx.Rollback()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		// database/sql rolls the transaction back by itself once the context
+		// is done, so ErrTxDone is expected here.
+		if rbErr != nil && rbErr != sql.ErrTxDone {
+			return ErrorPair{Err1: ctxErr, Err2: rbErr}
+		}
+		return ctxErr
+	}
+	if err == nil {
+		return rbErr
+	}
+	if rbErr != nil {
+		return ErrorPair{
+			Err1: err,
+			Err2: rbErr,
+		}
+	}
+	return err
+}
+
+// Apply applies all migrations in a single transaction, sorted by order and
+// name. Migrations that are already applied are skipped, so it's safe to pass
+// the complete list every time; see SetRequireNew for the strict behavior. It
+// returns the number of applied migrations and error if any. Errors of
+// individual migrations are wrapped in ErrMigrationFailed.
+//
+// NonTransactional migrations can't be part of the transaction, so they split
+// the batch: the migrations before one are committed, then it's applied and
+// recorded on its own, then the rest go on in a new transaction. Such a batch
+// is not atomic and a failure leaves its committed part applied, which is
+// reflected in the returned number.
 func (sch *Schema) Apply(migrations []Migration) (n int, err error) {
-	tx, err := sch.db.Begin()
+	return sch.ApplyContext(context.Background(), migrations)
+}
+
+// ApplyContext is like Apply but uses ctx for the transaction and every
+// statement in it. If ctx is done, the transaction is rolled back and
+// ctx.Err() is returned.
+func (sch *Schema) ApplyContext(ctx context.Context, migrations []Migration) (n int, err error) {
+	res, err := sch.ApplyResultContext(ctx, migrations)
+	return len(res.AppliedNames), err
+}
+
+// ApplyDry is like Apply but runs the migrations in dry mode: DryMigration
+// implementations get ApplyDry called instead of Apply, other migrations are
+// skipped, the migrations table is left untouched and the transaction is
+// always rolled back. It returns the number of migrations that would have
+// been applied.
+func (sch *Schema) ApplyDry(migrations []Migration) (n int, err error) {
+	return sch.ApplyDryContext(context.Background(), migrations)
+}
+
+// ApplyDryContext is like ApplyDry but uses ctx for the transaction.
+func (sch *Schema) ApplyDryContext(ctx context.Context, migrations []Migration) (n int, err error) {
+	return sch.withLock(ctx, func() (int, error) {
+		return sch.apply(ctx, migrations, true, nil)
+	})
+}
+
+// SetRequireNew makes Apply, ApplyEach, ApplyTx and MultiSchema.Apply, and
+// the methods built on them, insert every passed migration without checking
+// whether it's already applied, so passing an applied one fails on the unique
+// name constraint. ApplyOne has its own check and is not affected. It's
+// disabled by default.
+func (sch *Schema) SetRequireNew(enabled bool) {
+	sch.requireNew = enabled
+}
+
+// apply applies migrations and, if res is not nil, fills it in.
+func (sch *Schema) apply(ctx context.Context, migrations []Migration, isDry bool, res *Result) (n int, err error) {
+	ctx, end := sch.startBatch(ctx, "migration.apply_batch", isDry)
+	defer func() {
+		end(n, err)
+	}()
+
+	err = validate(migrations)
+	if err != nil {
+		return 0, err
+	}
+	err = sch.validateNames(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	migrations = SortMigrations(migrations)
+
+	var applied []string
+	var stats *runStats
+	if res != nil {
+		stats = &runStats{rows: map[string]int64{}}
+		defer func() {
+			res.AppliedNames, res.Skipped, res.RowsAffected = nil, applied, nil
+			res.Pending = len(migrations) - len(stats.skipped)
+			res.Executed, res.Failed = stats.executed, ""
+			var failErr ErrMigrationFailed
+			if errors.As(err, &failErr) && (failErr.Op == OpApply || failErr.Op == OpValidate) {
+				res.Failed = failErr.Name
+			}
+			done := 0
+			for _, m := range migrations {
+				if stats.skipped[m.Name()] || done >= n {
+					res.Skipped = append(res.Skipped, m.Name())
+					continue
+				}
+
+				done++
+				res.AppliedNames = append(res.AppliedNames, m.Name())
+				if k, ok := stats.rows[m.Name()]; ok {
+					if res.RowsAffected == nil {
+						res.RowsAffected = map[string]int64{}
+					}
+					res.RowsAffected[m.Name()] = k
+				}
+			}
+		}()
+	}
+
+	if !isDry {
+		err = sch.ensureInit(ctx)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if !sch.requireNew {
+		migrations, applied, err = sch.skipApplied(ctx, migrations, isDry)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	now := sch.clock.Now()
+	if isDry {
+		return sch.applyTx(ctx, migrations, now, txDry, nil)
+	}
+
+	for rest := migrations; len(rest) > 0; {
+		if nt, ok := rest[0].(NonTransactional); ok {
+			err = sch.applyNoTx(ctx, nt, now)
+			if err != nil {
+				return n, err
+			}
+
+			n++
+			stats.ran()
+			rest = rest[1:]
+			continue
+		}
+
+		i := 1
+		for i < len(rest) && !isNonTransactional(rest[i]) {
+			i++
+		}
+
+		k, err := sch.applyTx(ctx, rest[:i], now, txApply, stats)
+		n += k
+		if err != nil {
+			return n, err
+		}
+		rest = rest[i:]
+	}
+
+	return n, nil
+}
+
+// skipApplied splits migrations into unapplied ones and names of applied
+// ones. In dry mode a missing migrations table means nothing is applied.
+func (sch *Schema) skipApplied(ctx context.Context, migrations []Migration, isDry bool) (unapplied []Migration, applied []string, err error) {
+	if isDry {
+		exists, err := sch.tableExists(ctx)
+		if err != nil || !exists {
+			return migrations, nil, err
+		}
+	}
+
+	return sch.skipAppliedIn(ctx, sch.db, migrations)
+}
+
+// skipAppliedIn is like skipApplied but reads the migrations table with q.
+// When q is a transaction holding the transaction lock, the result holds
+// until the transaction ends.
+func (sch *Schema) skipAppliedIn(ctx context.Context, q queryer, migrations []Migration) (unapplied []Migration, applied []string, err error) {
+	appliedNames := map[string]bool{}
+	err = sch.scanAppliedNames(ctx, q, func(name string) {
+		appliedNames[name] = true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, m := range migrations {
+		if appliedNames[m.Name()] {
+			applied = append(applied, m.Name())
+		} else {
+			unapplied = append(unapplied, m)
+		}
+	}
+
+	return unapplied, applied, nil
+}
+
+// txMode is the way applyTx runs migrations.
+type txMode int
+
+const (
+	// txApply applies migrations and commits them.
+	txApply txMode = iota
+	// txDry runs the dry variants of migrations.
+	txDry
+	// txSimulate applies migrations and records them like txApply, after
+	// initializing the migrations table in the transaction if needed, but
+	// always rolls the transaction back.
+	txSimulate
+)
+
+// applyTx applies migrations in a single transaction. With savepoints, a
+// failed migration is rolled back alone and the ones before it are committed.
+// If stats is not nil, the migrations are counted in it.
+func (sch *Schema) applyTx(ctx context.Context, migrations []Migration, now time.Time, mode txMode, stats *runStats) (n int, err error) {
+	tx, err := beginTx(ctx, sch.db, sch.txOptions())
+	if err != nil {
+		return 0, err
+	}
+
+	isDry := mode == txDry
+	savepoints := sch.savepoints && !isDry
+	var batch *recordBatch
+	if !savepoints && !isDry {
+		// A failed record is rolled back with its savepoint, so records are
+		// batched only without savepoints.
+		batch = &recordBatch{}
+	}
+
+	partial := false
+	defer func() {
+		commit := (err == nil || partial) && mode == txApply
+		if commit && sch.beforeCommit != nil {
+			hookErr := sch.beforeCommit(tx)
+			if hookErr != nil {
+				if err != nil {
+					hookErr = ErrorPair{Err1: err, Err2: hookErr}
+				}
+				n, err, commit = 0, hookErr, false
+			}
+		}
+		err = endTx(ctx, tx, err, commit)
+	}()
+
+	if mode == txSimulate {
+		err = sch.ensureInitIn(ctx, tx)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = sch.prepareTx(ctx, tx, isDry)
+	if err != nil {
+		return 0, err
+	}
+
+	if !isDry && !sch.requireNew {
+		// A concurrent run may have applied some of the migrations while
+		// this one was waiting for the transaction lock.
+		var applied []string
+		migrations, applied, err = sch.skipAppliedIn(ctx, tx, migrations)
+		if err != nil {
+			return 0, err
+		}
+		stats.skip(applied)
+	}
+
+	err = validateAll(tx, migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range migrations {
+		err = ctx.Err()
+		if err != nil {
+			return 0, err
+		}
+
+		if savepoints {
+			_, err = tx.ExecContext(ctx, `SAVEPOINT `+savepointName)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		err = sch.applyOne(ctx, tx, m, now, isDry, batch, stats)
+		if err != nil && savepoints {
+			_, spErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT `+savepointName)
+			if spErr != nil {
+				return 0, ErrorPair{Err1: err, Err2: spErr}
+			}
+
+			partial = true
+			return n, err
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if savepoints {
+			_, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT `+savepointName)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		n++
+	}
+
+	if batch != nil {
+		err = sch.flushBatch(ctx, tx, batch)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return n, nil
+}
+
+// runStats collects what happened to the migrations of a run for Result.
+type runStats struct {
+	// rows are the rows affected by RowsMigration migrations by name.
+	rows map[string]int64
+	// executed is the number of migrations that ran without an error,
+	// whether committed or not.
+	executed int
+	// skipped are the names of the migrations found applied once the
+	// transaction lock was taken.
+	skipped map[string]bool
+}
+
+// ran counts a migration that ran without an error. It's a no-op on nil.
+func (st *runStats) ran() {
+	if st != nil {
+		st.executed++
+	}
+}
+
+// skip adds names to the skipped migrations. It's a no-op on nil.
+func (st *runStats) skip(names []string) {
+	if st == nil {
+		return
+	}
+
+	for _, name := range names {
+		if st.skipped == nil {
+			st.skipped = map[string]bool{}
+		}
+		st.skipped[name] = true
+	}
+}
+
+// savepointName is the name of the savepoint wrapping each migration.
+const savepointName = "migration"
+
+// applyOne applies m in tx and records it unless isDry is true. If batch is
+// not nil, the record is added to it instead of being inserted right away. If
+// stats is not nil, m is counted in it along with the rows it affected if
+// it's a RowsMigration.
+func (sch *Schema) applyOne(ctx context.Context, tx *sql.Tx, m Migration, now time.Time, isDry bool, batch *recordBatch, stats *runStats) (err error) {
+	ctx, span := sch.startSpan(ctx, "migration.apply")
+	span.SetAttribute("migration.name", m.Name())
+	defer func() {
+		span.End(err)
+	}()
+
+	err = callHook(sch.beforeEach, m.Name(), isDry)
+	if err != nil {
+		return err
+	}
+
+	sch.logger.BeforeApply(m.Name())
+	start := time.Now()
+	affected := int64(-1)
+	err = sch.ignoring(ctx, tx, m, span, func() error {
+		return sch.withTimeout(ctx, m, func(ctx context.Context) error {
+			q, ok, err := sch.rewrittenSQL(m)
+			if err != nil || (ok && isDry) {
+				return err
+			}
+			if ok {
+				k, err := execRows(ctx, tx, q)
+				if _, isRows := m.(RowsMigration); isRows {
+					affected = k
+				}
+				return err
+			}
+			if rm, ok := m.(RowsMigration); ok && !isDry {
+				var err error
+				affected, err = rm.ApplyRows(ctx, tx)
+				return err
+			}
+			return applyMigration(ctx, tx, m, isDry)
+		})
+	})
+	if err != nil {
+		return failed(m.Name(), OpApply, err)
+	}
+	if stats != nil && affected >= 0 {
+		stats.rows[m.Name()] = affected
+	}
+	d := time.Since(start)
+	sch.logger.AfterApply(m.Name(), d)
+	stats.ran()
+
+	err = callHook(sch.afterEach, m.Name(), isDry)
+	if err != nil {
+		return err
+	}
+
+	if isDry {
+		return nil
+	}
+
+	if batch != nil {
+		batch.add(m.Name(), now, checksumOf(m), d.Milliseconds())
+		return nil
+	}
+
+	return sch.record(ctx, tx, m.Name(), now, checksumOf(m), d.Milliseconds())
+}
+
+// SetBeforeCommit sets a hook called inside every transaction of Apply and
+// ApplyEach right before it's committed, e.g. to check invariants spanning
+// several migrations. If the hook returns an error, the transaction is rolled
+// back. It's not called in dry runs.
+func (sch *Schema) SetBeforeCommit(hook func(tx *sql.Tx) error) {
+	sch.beforeCommit = hook
+}
+
+// SetPerMigrationHooks sets hooks called right before and right after each
+// migration is applied by Apply and its variants, inside its transaction.
+// Both are called in dry runs too, with isDry set. A hook error aborts the
+// batch, rolling the transaction back. Either hook may be nil.
+func (sch *Schema) SetPerMigrationHooks(before, after func(name string, isDry bool) error) {
+	sch.beforeEach = before
+	sch.afterEach = after
+}
+
+// callHook calls a per-migration hook unless it's nil.
+func callHook(hook func(name string, isDry bool) error, name string, isDry bool) error {
+	if hook == nil {
+		return nil
+	}
+	return hook(name, isDry)
+}
+
+// SetIsolation sets the isolation level of the transactions of Apply, Rollback
+// and their variants to one of the sql.Level constants, e.g.
+// sql.LevelSerializable for data migrations that must not see concurrent
+// writes. The default is sql.LevelDefault, the driver's default level.
+func (sch *Schema) SetIsolation(level sql.IsolationLevel) {
+	sch.isolation = level
+}
+
+// txOptions returns the options of the transactions of sch.
+func (sch *Schema) txOptions() *sql.TxOptions {
+	if sch.isolation == sql.LevelDefault {
+		return nil
+	}
+	return &sql.TxOptions{Isolation: sch.isolation}
+}
+
+// SetSearchPath makes every transaction of Apply, Rollback and their variants
+// start by setting the search path to the schema for the duration of the
+// transaction, so that migrations can use unqualified table names. It's only
+// supported by dialects implementing SearchPather and ignored by others. It
+// doesn't affect transactions passed to ApplyTx. It's disabled by default.
+func (sch *Schema) SetSearchPath(enabled bool) {
+	sch.searchPath = enabled
+}
+
+// prepareTx runs the statements starting every transaction of sch: setting
+// the search path if enabled and taking the transaction lock unless isDry is
+// true.
+func (sch *Schema) prepareTx(ctx context.Context, tx *sql.Tx, isDry bool) error {
+	if sp, ok := sch.dialect.(SearchPather); ok && sch.searchPath {
+		_, err := tx.ExecContext(ctx, sp.SetSearchPath(sch.schemaName))
+		if err != nil {
+			return err
+		}
+	}
+
+	if isDry {
+		return nil
+	}
+	return sch.lockTx(ctx, tx)
+}
+
+// SetSavepoints makes Apply wrap each migration in a savepoint, so that a
+// failed migration is rolled back alone while the ones applied before it in
+// the same transaction are committed. Apply then returns their number along
+// with ErrMigrationFailed. It's disabled by default.
+func (sch *Schema) SetSavepoints(enabled bool) {
+	sch.savepoints = enabled
+}
+
+// applyNoTx applies a non-transactional migration and records it in a
+// transaction of its own.
+func (sch *Schema) applyNoTx(ctx context.Context, m NonTransactional, now time.Time) (err error) {
+	ctx, span := sch.startSpan(ctx, "migration.apply")
+	span.SetAttribute("migration.name", m.Name())
+	defer func() {
+		span.End(err)
+	}()
+
+	err = callHook(sch.beforeEach, m.Name(), false)
+	if err != nil {
+		return err
+	}
+
+	sch.logger.BeforeApply(m.Name())
+	start := time.Now()
+	err = sch.ignoring(ctx, nil, m, span, func() error {
+		return sch.withTimeout(ctx, m, func(ctx context.Context) error {
+			return m.ApplyNoTx(ctx, sch.db)
+		})
+	})
+	if err != nil {
+		return failed(m.Name(), OpApply, err)
+	}
+	d := time.Since(start)
+	sch.logger.AfterApply(m.Name(), d)
+
+	err = callHook(sch.afterEach, m.Name(), false)
+	if err != nil {
+		return err
+	}
+
+	return sch.recordTx(ctx, m.Name(), now, checksumOf(m), d.Milliseconds())
+}
+
+// ApplyEach applies each migration in a separate transaction, which also
+// records it in the migrations table. Migrations that are already applied
+// are skipped like in Apply. It stops at the first failure and returns the
+// number of committed migrations along with the error. Unlike with Apply,
+// migrations committed before the failure stay applied.
+func (sch *Schema) ApplyEach(migrations []Migration) (n int, err error) {
+	return sch.ApplyEachContext(context.Background(), migrations)
+}
+
+// ApplyEachContext is like ApplyEach but uses ctx for the transactions and
+// every statement in them.
+func (sch *Schema) ApplyEachContext(ctx context.Context, migrations []Migration) (n int, err error) {
+	return sch.withLock(ctx, func() (int, error) {
+		return sch.applyEach(ctx, migrations)
+	})
+}
+
+func (sch *Schema) applyEach(ctx context.Context, migrations []Migration) (n int, err error) {
+	ctx, end := sch.startBatch(ctx, "migration.apply_batch", false)
+	defer func() {
+		end(n, err)
+	}()
+
+	err = validate(migrations)
+	if err != nil {
+		return 0, err
+	}
+	err = sch.validateNames(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	migrations = SortMigrations(migrations)
+
+	err = sch.ensureInit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if !sch.requireNew {
+		migrations, _, err = sch.skipApplied(ctx, migrations, false)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	now := sch.clock.Now()
+	for _, m := range migrations {
+		if nt, ok := m.(NonTransactional); ok {
+			err = sch.applyNoTx(ctx, nt, now)
+		} else {
+			_, err = sch.applyTx(ctx, []Migration{m}, now, txApply, nil)
+		}
+		if err != nil {
+			return n, err
+		}
+
+		n++
+	}
+
+	return n, nil
+}
+
+// Rollback rolls back all migrations in a single transaction, in the reverse of
+// the order Apply applies them in, whatever their order in the slice. It
+// returns the number of rolled back migrations and error if any.
+// NonTransactional migrations split the batch the same way they do in Apply.
+func (sch *Schema) Rollback(migrations []Migration) (n int, err error) {
+	return sch.RollbackContext(context.Background(), migrations)
+}
+
+// RollbackContext is like Rollback but uses ctx for the transaction and every
+// statement in it. If ctx is done, the transaction is rolled back and
+// ctx.Err() is returned.
+func (sch *Schema) RollbackContext(ctx context.Context, migrations []Migration) (n int, err error) {
+	migrations, err = reverseSorted(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	return sch.rollbackInOrder(ctx, migrations)
+}
+
+// rollbackInOrder rolls back migrations in the given order like Rollback.
+func (sch *Schema) rollbackInOrder(ctx context.Context, migrations []Migration) (int, error) {
+	return sch.withLock(ctx, func() (int, error) {
+		return sch.rollback(ctx, migrations, false)
+	})
+}
+
+// reverseSorted validates migrations and returns a copy of them sorted in
+// the reverse of the apply order.
+func reverseSorted(migrations []Migration) ([]Migration, error) {
+	err := validate(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	res := SortMigrations(migrations)
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res, nil
+}
+
+// RollbackDry is like Rollback but runs the migrations in dry mode:
+// DryMigration implementations get RollbackDry called instead of Rollback,
+// other migrations are skipped, the migrations table is left untouched and the
+// transaction is always rolled back. It returns the number of migrations that
+// would have been rolled back.
+func (sch *Schema) RollbackDry(migrations []Migration) (n int, err error) {
+	return sch.RollbackDryContext(context.Background(), migrations)
+}
+
+// RollbackDryContext is like RollbackDry but uses ctx for the transaction.
+func (sch *Schema) RollbackDryContext(ctx context.Context, migrations []Migration) (n int, err error) {
+	migrations, err = reverseSorted(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	return sch.withLock(ctx, func() (int, error) {
+		return sch.rollback(ctx, migrations, true)
+	})
+}
+
+func (sch *Schema) rollback(ctx context.Context, migrations []Migration, isDry bool) (n int, err error) {
+	ctx, end := sch.startBatch(ctx, "migration.rollback_batch", isDry)
+	defer func() {
+		end(n, err)
+	}()
+
+	err = validateRollback(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	if isDry {
+		return sch.rollbackTx(ctx, migrations, true, false)
+	}
+
+	err = sch.ensureInit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for len(migrations) > 0 {
+		if nt, ok := migrations[0].(NonTransactional); ok {
+			err = sch.rollbackNoTx(ctx, nt, false)
+			if err != nil {
+				return n, err
+			}
+
+			n++
+			migrations = migrations[1:]
+			continue
+		}
+
+		i := 1
+		for i < len(migrations) && !isNonTransactional(migrations[i]) {
+			i++
+		}
+
+		k, err := sch.rollbackTx(ctx, migrations[:i], false, false)
+		if err != nil {
+			return n, err
+		}
+
+		n += k
+		migrations = migrations[i:]
+	}
+
+	return n, nil
+}
+
+// rollbackTx rolls back migrations in a single transaction. If force is true,
+// they aren't checked to be applied.
+func (sch *Schema) rollbackTx(ctx context.Context, migrations []Migration, isDry, force bool) (n int, err error) {
+	tx, err := beginTx(ctx, sch.db, sch.txOptions())
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		err = endTx(ctx, tx, err, err == nil && !isDry)
+	}()
+
+	err = sch.prepareTx(ctx, tx, isDry)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range migrations {
+		err = ctx.Err()
+		if err != nil {
+			return 0, err
+		}
+
+		err = sch.rollbackOne(ctx, tx, m, isDry, force)
+		if err != nil {
+			return 0, err
+		}
+
+		n++
+	}
+
+	return n, nil
+}
+
+// rollbackOne rolls back m in tx and deletes its record unless isDry is true.
+// If force is true, m isn't checked to be applied.
+func (sch *Schema) rollbackOne(ctx context.Context, tx *sql.Tx, m Migration, isDry, force bool) (err error) {
+	ctx, span := sch.startSpan(ctx, "migration.rollback")
+	span.SetAttribute("migration.name", m.Name())
+	defer func() {
+		span.End(err)
+	}()
+
+	if !force {
+		err = sch.checkApplied(ctx, tx, m.Name())
+		if err != nil {
+			return err
+		}
+	}
+
+	sch.logger.BeforeRollback(m.Name())
+	start := time.Now()
+	err = rollbackMigration(ctx, tx, m, isDry)
+	if err != nil {
+		return failed(m.Name(), OpRollback, err)
+	}
+	sch.logger.AfterRollback(m.Name(), time.Since(start))
+
+	if isDry {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, sch.queries.delete, m.Name())
+	return failed(m.Name(), OpUnrecord, err)
+}
+
+// rollbackNoTx rolls back a non-transactional migration and deletes its
+// record. If force is true, m isn't checked to be applied.
+func (sch *Schema) rollbackNoTx(ctx context.Context, m NonTransactional, force bool) (err error) {
+	ctx, span := sch.startSpan(ctx, "migration.rollback")
+	span.SetAttribute("migration.name", m.Name())
+	defer func() {
+		span.End(err)
+	}()
+
+	if !force {
+		err = sch.checkApplied(ctx, sch.db, m.Name())
+		if err != nil {
+			return err
+		}
+	}
+
+	sch.logger.BeforeRollback(m.Name())
+	start := time.Now()
+	err = m.RollbackNoTx(ctx, sch.db)
+	if err != nil {
+		return failed(m.Name(), OpRollback, err)
+	}
+	sch.logger.AfterRollback(m.Name(), time.Since(start))
+
+	_, err = sch.db.ExecContext(ctx, sch.queries.delete, m.Name())
+	return failed(m.Name(), OpUnrecord, err)
+}
+
+// SetRequireApplied makes Rollback and its variants check that every
+// migration is applied before rolling it back, returning ErrNotApplied
+// otherwise. It's disabled by default.
+func (sch *Schema) SetRequireApplied(enabled bool) {
+	sch.requireApplied = enabled
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// checkApplied returns ErrNotApplied if the migration named name is not
+// applied and applied migrations are required.
+func (sch *Schema) checkApplied(ctx context.Context, q queryRower, name string) error {
+	if !sch.requireApplied {
+		return nil
+	}
+
+	applied, err := sch.isApplied(ctx, q, name)
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return ErrNotApplied{Name: name}
+	}
+	return nil
+}
+
+// isApplied reports whether the migration named name is recorded.
+func (sch *Schema) isApplied(ctx context.Context, q queryRower, name string) (bool, error) {
+	var n int
+	err := q.QueryRowContext(ctx, sch.queries.count, name).Scan(&n)
+	return n > 0, err
+}
+
+// RollbackEach rolls back each migration in a separate transaction, in the
+// same order as Rollback. It stops at the first failure and returns the
+// number of committed rollbacks along with the error.
+func (sch *Schema) RollbackEach(migrations []Migration) (n int, err error) {
+	return sch.RollbackEachContext(context.Background(), migrations)
+}
+
+// RollbackEachContext is like RollbackEach but uses ctx for the transactions
+// and every statement in them.
+func (sch *Schema) RollbackEachContext(ctx context.Context, migrations []Migration) (n int, err error) {
+	migrations, err = reverseSorted(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	return sch.withLock(ctx, func() (int, error) {
+		return sch.rollbackEach(ctx, migrations)
+	})
+}
+
+func (sch *Schema) rollbackEach(ctx context.Context, migrations []Migration) (n int, err error) {
+	ctx, end := sch.startBatch(ctx, "migration.rollback_batch", false)
+	defer func() {
+		end(n, err)
+	}()
+
+	err = validateRollback(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	err = sch.ensureInit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range migrations {
+		if nt, ok := m.(NonTransactional); ok {
+			err = sch.rollbackNoTx(ctx, nt, false)
+		} else {
+			_, err = sch.rollbackTx(ctx, []Migration{m}, false, false)
+		}
+		if err != nil {
+			return n, err
+		}
+
+		n++
+	}
+
+	return n, nil
+}
+
+// Init creates a migrations table in the database. A table created by an older
+// version of the package is upgraded in place by adding the missing optional
+// columns: checksum, duration_ms, id and source. It returns ErrMissingColumn
+// if the table lacks the name or the applied_at column, which can't be filled
+// in for existing records. It's safe to call Init every time and concurrently.
+func (sch *Schema) Init() error {
+	return sch.InitContext(context.Background())
+}
+
+// InitContext is like Init but uses ctx for the statements.
+func (sch *Schema) InitContext(ctx context.Context) error {
+	return sch.init(ctx, sch.db)
+}
+
+// initDB runs the statements of init: it's either the DB of a Schema or a
+// transaction.
+type initDB interface {
+	execQueryRower
+	queryer
+}
+
+// init creates or upgrades the migrations table with db.
+func (sch *Schema) init(ctx context.Context, db initDB) error {
+	var err error
+	q := sch.dialect.CreateSchema(sch.migTableSchema)
+	if q != "" {
+		_, err = db.ExecContext(ctx, q)
+		if err != nil {
+			return err
+		}
+	}
+
+	var defs []string
+	for _, c := range sch.columns() {
+		defs = append(defs, sch.dialect.QuoteIdent(c.name)+" "+sch.dialect.ColumnType(c.typ))
+	}
+	q = `CREATE TABLE IF NOT EXISTS ` + sch.table() + ` (` + strings.Join(defs, ", ") + `)`
+	_, err = db.ExecContext(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	// Tables created by older versions lack some of the columns, which are
+	// added in place.
+	existing, err := sch.queryColumns(ctx, db)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	defer func() {
-		if err == nil {
-			err = tx.Commit()
-		} else {
-			rbErr := tx.Rollback()
-			if rbErr != nil {
-				err = ErrorPair{
-					Err1: err,
-					Err2: rbErr,
-				}
-			}
+	for _, c := range sch.columns() {
+		if existing[c.name] {
+			continue
 		}
-	}()
-
-	now := time.Now()
-	q := `INSERT INTO "` + sch.schemaName + `"` + `."` + sch.migTableName + `" (name, applied_at) ` +
-		`VALUES ($1, $2)`
-	for _, m := range migrations {
-		err = m.Apply(tx)
-		if err != nil {
-			return 0, err
+		if c.required {
+			return ErrMissingColumn{Name: c.name}
 		}
 
-		_, err = tx.Exec(q, m.Name(), now)
+		err = sch.addColumn(ctx, db, c)
 		if err != nil {
-			return 0, err
+			return err
 		}
-
-		n++
 	}
 
-	return n, nil
+	return nil
 }
 
-// ApplyEach applies each migration in a separate transaction. It returns the number
-// of applied migrations and error if any.
-func (sch *Schema) ApplyEach(migrations []Migration) (n int, err error) {
-	now := time.Now()
-	q := `INSERT INTO "` + sch.schemaName + `"` + `."` + sch.migTableName + `" (name, applied_at) ` +
-		`VALUES ($1, $2)`
-	var tx *sql.Tx
-
-	for _, m := range migrations {
-		err = func() (err error) {
-			tx, err = sch.db.Begin()
-			if err != nil {
-				return err
-			}
+// ErrMissingColumn is returned by Init when an existing migrations table lacks
+// a column that can't be added in place, e.g. because it was created with
+// different names than those set by SetColumns.
+type ErrMissingColumn struct {
+	Name string
+}
 
-			defer func() {
-				if err == nil {
-					err = tx.Commit()
-				} else {
-					rbErr := tx.Rollback()
-					if rbErr != nil {
-						err = ErrorPair{
-							Err1: err,
-							Err2: rbErr,
-						}
-					}
-				}
-			}()
+// Error implements the error interface for ErrMissingColumn.
+func (err ErrMissingColumn) Error() string {
+	return fmt.Sprintf("migrations table has no %q column", err.Name)
+}
 
-			err = m.Apply(tx)
-			if err != nil {
-				return err
-			}
+var _ error = ErrMissingColumn{}
+
+// addColumn adds c to the migrations table. Not every database supports ADD
+// COLUMN IF NOT EXISTS, so if adding fails because a concurrent Init has just
+// added the column, the error is ignored.
+func (sch *Schema) addColumn(ctx context.Context, db initDB, c column) error {
+	q := `ALTER TABLE ` + sch.table() + ` ADD COLUMN ` +
+		sch.dialect.QuoteIdent(c.name) + ` ` + sch.dialect.ColumnType(c.typ)
+	_, err := db.ExecContext(ctx, q)
+	if err == nil {
+		return nil
+	}
 
-			_, err = tx.Exec(q, m.Name(), now)
-			if err != nil {
-				return err
-			}
+	existing, colErr := sch.queryColumns(ctx, db)
+	if colErr == nil && existing[c.name] {
+		return nil
+	}
+	return err
+}
 
-			n++
-			return nil
-		}()
+type column struct {
+	name string
+	typ  ColumnType
+	// required columns are never added to existing tables.
+	required bool
+}
 
-		if err != nil {
-			return n, err
-		}
+// columns returns the columns of the migrations table.
+func (sch *Schema) columns() []column {
+	return []column{
+		{name: sch.cols.Name, typ: TypeName, required: true},
+		{name: sch.cols.AppliedAt, typ: TypeTime, required: true},
+		{name: checksumColumn, typ: TypeText},
+		{name: durationColumn, typ: TypeInt},
+		{name: idColumn, typ: TypeID},
+		{name: sourceColumn, typ: TypeText},
 	}
-
-	return n, nil
 }
 
-// Rollback rolls back all migrations in a single transaction. It returns the
-// number of rolled back migrations and error if any.
-func (sch *Schema) Rollback(migrations []Migration) (n int, err error) {
-	tx, err := sch.db.Begin()
+// queryColumns returns the set of column names of the migrations table, read
+// with q.
+func (sch *Schema) queryColumns(ctx context.Context, q queryer) (res map[string]bool, err error) {
+	rows, err := q.QueryContext(ctx, sch.queries.columns)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	defer func() {
-		if err == nil {
-			err = tx.Commit()
-		} else {
-			rbErr := tx.Rollback()
-			if rbErr != nil {
-				err = ErrorPair{
-					Err1: err,
-					Err2: rbErr,
-				}
+		closeErr := rows.Close()
+		if closeErr != nil {
+			if err != nil {
+				err = ErrorPair{Err1: err, Err2: closeErr}
+			} else {
+				err = closeErr
 			}
 		}
 	}()
 
-	q := `DELETE FROM "` + sch.schemaName + `"` + `."` + sch.migTableName + `" ` +
-		`WHERE name = $1`
-	for _, m := range migrations {
-		err = m.Rollback(tx)
-		if err != nil {
-			return 0, err
-		}
-
-		_, err = tx.Exec(q, m.Name())
-		if err != nil {
-			return 0, err
-		}
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
 
-		n++
+	res = map[string]bool{}
+	for _, name := range names {
+		res[name] = true
 	}
 
-	return n, nil
+	return res, nil
 }
 
-// RollbackEach rolls back each migration in a separate transaction. It returns the
-// number of rolled back migrations and error if any.
-func (sch *Schema) RollbackEach(migrations []Migration) (n int, err error) {
-	q := `DELETE FROM "` + sch.schemaName + `"` + `."` + sch.migTableName + `" ` +
-		`WHERE name = $1`
-	var tx *sql.Tx
+// ErrNameNotUnique is returned whenever a non-unique migration name is found.
+type ErrNameNotUnique struct {
+	Name string
+}
 
-	for _, m := range migrations {
-		err = func() (err error) {
-			tx, err = sch.db.Begin()
-			if err != nil {
-				return err
-			}
+// Error implements the error interface for ErrNameNotUnique.
+func (err ErrNameNotUnique) Error() string {
+	return fmt.Sprintf("migration name not unique: %q", err.Name)
+}
 
-			defer func() {
-				if err == nil {
-					err = tx.Commit()
-				} else {
-					rbErr := tx.Rollback()
-					if rbErr != nil {
-						err = ErrorPair{
-							Err1: err,
-							Err2: rbErr,
-						}
-					}
-				}
-			}()
+var _ error = ErrNameNotUnique{}
 
-			err = m.Rollback(tx)
-			if err != nil {
-				return err
-			}
+// ErrEmptyName is returned whenever a migration with an empty name is found.
+var ErrEmptyName = errors.New("migration name is empty")
 
-			_, err = tx.Exec(q, m.Name())
-			if err != nil {
-				return err
-			}
+// ErrNilMigration is returned whenever a nil migration is found.
+type ErrNilMigration struct {
+	Index int
+}
 
-			n++
-			return nil
-		}()
+// Error implements the error interface for ErrNilMigration.
+func (err ErrNilMigration) Error() string {
+	return fmt.Sprintf("migration at index %d is nil", err.Index)
+}
 
-		if err != nil {
-			return n, err
+var _ error = ErrNilMigration{}
+
+// indexByName returns migrations by name. It returns ErrEmptyName or
+// ErrNameNotUnique if some of the names are invalid.
+func indexByName(migrations []Migration) (map[string]Migration, error) {
+	migByName := map[string]Migration{}
+	for i, m := range migrations {
+		if m == nil {
+			return nil, ErrNilMigration{Index: i}
+		}
+		if m.Name() == "" {
+			return nil, ErrEmptyName
 		}
+		if migByName[m.Name()] != nil {
+			return nil, ErrNameNotUnique{Name: m.Name()}
+		}
+		migByName[m.Name()] = m
 	}
+	return migByName, nil
+}
 
-	return n, nil
+// validate checks migrations before running them.
+func validate(migrations []Migration) error {
+	byName, err := indexByName(migrations)
+	if err != nil {
+		return err
+	}
+	return checkDependencies(migrations, byName)
 }
 
-// Init creates a migrations table in the database.
-func (sch *Schema) Init() error {
-	var err error
-	q := `CREATE SCHEMA IF NOT EXISTS "` + sch.schemaName + `"`
-	_, err = sch.db.Exec(q)
+// validateRollback checks migrations before rolling them back.
+func validateRollback(migrations []Migration) error {
+	err := validate(migrations)
 	if err != nil {
 		return err
 	}
 
-	q = `CREATE TABLE IF NOT EXISTS "` + sch.schemaName + `"` + `."` + sch.migTableName + `" ` +
-		`(name TEXT UNIQUE, applied_at TIMESTAMP)`
-	_, err = sch.db.Exec(q)
-	return err
+	for _, m := range migrations {
+		if isIrreversible(m) {
+			return ErrIrreversible{Name: m.Name()}
+		}
+	}
+	return nil
 }
 
-// ErrNameNotUnique is returned whenever a non-unique migration name is found.
-type ErrNameNotUnique struct {
+// ErrNotApplied is returned whenever a migration is expected to be applied but
+// it is not.
+type ErrNotApplied struct {
 	Name string
 }
 
-// Error implements the error interface for ErrNameNotUnique.
-func (err ErrNameNotUnique) Error() string {
-	return fmt.Sprintf("migration name not unique: %q", err.Name)
+// Error implements the error interface for ErrNotApplied.
+func (err ErrNotApplied) Error() string {
+	return fmt.Sprintf("migration not applied: %q", err.Name)
 }
 
-var _ error = ErrNameNotUnique{}
+var _ error = ErrNotApplied{}
+
+// Operations reported by ErrMigrationFailed.
+const (
+	// OpApply is running the migration's apply code.
+	OpApply = "apply"
+	// OpValidate is running the migration's Validate before applying.
+	OpValidate = "validate"
+	// OpRollback is running the migration's rollback code.
+	OpRollback = "rollback"
+	// OpRecord is inserting the migration into the migrations table.
+	OpRecord = "record"
+	// OpUnrecord is deleting the migration from the migrations table.
+	OpUnrecord = "unrecord"
+)
+
+// ErrMigrationFailed is returned when applying or rolling back a migration
+// fails. Op is one of OpApply, OpValidate, OpRollback, OpRecord and
+// OpUnrecord.
+type ErrMigrationFailed struct {
+	Name string
+	Op   string
+	Err  error
+}
+
+// Error implements the error interface for ErrMigrationFailed.
+func (err ErrMigrationFailed) Error() string {
+	return fmt.Sprintf("migration %q: %s failed: %v", err.Name, err.Op, err.Err)
+}
+
+// Unwrap returns the underlying error.
+func (err ErrMigrationFailed) Unwrap() error {
+	return err.Err
+}
+
+var _ error = ErrMigrationFailed{}
+
+// failed wraps a non-nil err of op on the migration named name in
+// ErrMigrationFailed.
+func failed(name, op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return ErrMigrationFailed{Name: name, Op: op, Err: err}
+}
 
 // ErrMigrationNotFound is returned by FindOne when migration is not found by
 // name.
 var ErrMigrationNotFound = errors.New("migration not found")
 
-// FindOne finds a migration by name
+// FindOne finds a migration by name in migrations. It doesn't query the
+// database; FindOneApplied tells whether a migration is applied.
 func (sch *Schema) FindOne(migrations []Migration, name string) (res []Migration, err error) {
 	for _, m := range migrations {
 		if m.Name() == name {
@@ -267,99 +1436,124 @@ func (sch *Schema) FindOne(migrations []Migration, name string) (res []Migration
 
 // FindUnapplied finds unapplied migrations.
 func (sch *Schema) FindUnapplied(migrations []Migration) (res []Migration, err error) {
-	if len(migrations) == 0 {
-		return nil, nil
-	}
-
-	migByName := map[string]Migration{}
-	for _, m := range migrations {
-		if migByName[m.Name()] != nil {
-			return nil, ErrNameNotUnique{Name: m.Name()}
-		}
-		migByName[m.Name()] = m
-	}
-
-	q := `SELECT name FROM "` + sch.schemaName + `"` + `."` + sch.migTableName + `"` +
-		`ORDER BY name`
+	return sch.FindUnappliedContext(context.Background(), migrations)
+}
 
-	rows, err := sch.db.Query(q)
+// FindUnappliedContext is like FindUnapplied but uses ctx for the query.
+func (sch *Schema) FindUnappliedContext(ctx context.Context, migrations []Migration) (res []Migration, err error) {
+	set, err := NewMigrationSet(migrations)
 	if err != nil {
 		return nil, err
 	}
 
-	defer func() {
-		closeErr := rows.Close()
-		if closeErr != nil {
-			if err != nil {
-				err = ErrorPair{Err1: err, Err2: closeErr}
-			} else {
-				err = closeErr
-			}
-		}
-	}()
+	return sch.FindUnappliedSetContext(ctx, set)
+}
 
-	var resNames []string
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
-			return nil, err
-		}
+// FindUnappliedSet is like FindUnapplied but takes an already validated set.
+func (sch *Schema) FindUnappliedSet(set *MigrationSet) (res []Migration, err error) {
+	return sch.FindUnappliedSetContext(context.Background(), set)
+}
 
-		resNames = append(resNames, name)
+// FindUnappliedSetContext is like FindUnappliedSet but uses ctx for the query.
+func (sch *Schema) FindUnappliedSetContext(ctx context.Context, set *MigrationSet) (res []Migration, err error) {
+	if set.Len() == 0 && !sch.strict {
+		return nil, nil
 	}
 
-	if err := rows.Err(); err != nil {
+	err = sch.ensureInit(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	for _, name := range resNames {
-		if _, ok := migByName[name]; ok {
-			delete(migByName, name)
-		}
+	applied, unknown, err := sch.queryAppliedIn(ctx, set, sch.strict)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, m := range migByName {
-		res = append(res, m)
+	if len(unknown) > 0 {
+		return nil, ErrUnknownApplied{Names: unknown}
 	}
 
-	sort.Sort(migrationsByName(res))
+	for _, m := range set.migrations {
+		if !applied[m.Name()] {
+			res = append(res, m)
+		}
+	}
 
 	return res, nil
 }
 
-type migrationsByName []Migration
-
-func (ms migrationsByName) Len() int           { return len(ms) }
-func (ms migrationsByName) Less(i, j int) bool { return ms[i].Name() < ms[j].Name() }
-func (ms migrationsByName) Swap(i, j int)      { ms[i], ms[j] = ms[j], ms[i] }
-
-type migrationsByNameDesc []Migration
+// FindApplied finds applied migrations, sorted by order and name.
+func (sch *Schema) FindApplied(migrations []Migration) ([]Migration, error) {
+	return sch.FindAppliedContext(context.Background(), migrations)
+}
 
-func (ms migrationsByNameDesc) Len() int           { return len(ms) }
-func (ms migrationsByNameDesc) Less(i, j int) bool { return ms[j].Name() < ms[i].Name() }
-func (ms migrationsByNameDesc) Swap(i, j int)      { ms[i], ms[j] = ms[j], ms[i] }
+// FindAppliedContext is like FindApplied but uses ctx for the query.
+func (sch *Schema) FindAppliedContext(ctx context.Context, migrations []Migration) (res []Migration, err error) {
+	set, err := NewMigrationSet(migrations)
+	if err != nil {
+		return nil, err
+	}
 
-// FindUnrolled finds migrations that were not rolled back.
-func (sch *Schema) FindUnrolled(migrations []Migration) (res []Migration, err error) {
-	if len(migrations) == 0 {
+	if set.Len() == 0 {
 		return nil, nil
 	}
 
-	migByName := map[string]Migration{}
-	for _, m := range migrations {
-		if migByName[m.Name()] != nil {
-			return nil, ErrNameNotUnique{Name: m.Name()}
+	applied, _, err := sch.queryAppliedIn(ctx, set, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range set.migrations {
+		if applied[m.Name()] {
+			res = append(res, m)
 		}
-		migByName[m.Name()] = m
 	}
 
-	q := `SELECT name FROM "` + sch.schemaName + `"` + `."` + sch.migTableName + `"` +
-		`ORDER BY name DESC`
+	return res, nil
+}
 
-	rows, err := sch.db.Query(q)
+// queryAppliedNames returns the set of names in the migrations table.
+func (sch *Schema) queryAppliedNames(ctx context.Context) (map[string]bool, error) {
+	res := map[string]bool{}
+	err := sch.scanAppliedNames(ctx, sch.db, func(name string) {
+		res[name] = true
+	})
 	if err != nil {
 		return nil, err
 	}
+	return res, nil
+}
+
+// queryAppliedIn returns the set of names in the migrations table that are in
+// set and, if withUnknown is true, the other names sorted. Unlike
+// queryAppliedNames, it takes memory proportional to set rather than to the
+// table, which matters for tables with many thousands of records.
+func (sch *Schema) queryAppliedIn(ctx context.Context, set *MigrationSet, withUnknown bool) (applied map[string]bool, unknown []string, err error) {
+	applied = make(map[string]bool, set.Len())
+	err = sch.scanAppliedNames(ctx, sch.db, func(name string) {
+		if set.ByName(name) != nil {
+			applied[name] = true
+		} else if withUnknown {
+			unknown = append(unknown, name)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Strings(unknown)
+
+	return applied, unknown, nil
+}
+
+// scanAppliedNames calls f with every name in the migrations table, read with
+// q, as the rows are read.
+func (sch *Schema) scanAppliedNames(ctx context.Context, q queryer, f func(name string)) (err error) {
+	rows, err := q.QueryContext(ctx, sch.queries.names)
+	if err != nil {
+		return err
+	}
 
 	defer func() {
 		closeErr := rows.Close()
@@ -372,31 +1566,157 @@ func (sch *Schema) FindUnrolled(migrations []Migration) (res []Migration, err er
 		}
 	}()
 
-	var resNames []string
 	for rows.Next() {
 		var name string
 		if err := rows.Scan(&name); err != nil {
-			return nil, err
+			return err
 		}
 
-		resNames = append(resNames, name)
+		f(name)
+	}
+
+	return rows.Err()
+}
+
+// migrationsByOrder sorts migrations by Order, treating migrations that aren't
+// Ordered as having order 0, and then by name.
+type migrationsByOrder []Migration
+
+func (ms migrationsByOrder) Len() int { return len(ms) }
+func (ms migrationsByOrder) Less(i, j int) bool {
+	oi, oj := orderOf(ms[i]), orderOf(ms[j])
+	if oi != oj {
+		return oi < oj
+	}
+	return ms[i].Name() < ms[j].Name()
+}
+func (ms migrationsByOrder) Swap(i, j int) { ms[i], ms[j] = ms[j], ms[i] }
+
+// SortMigrations returns a copy of migrations sorted in the order Apply
+// applies them: by Order, treating migrations that aren't Ordered as having
+// order 0, and then by name, moving Dependent migrations after their
+// dependencies. The sort is stable. It doesn't need a database.
+func SortMigrations(migrations []Migration) []Migration {
+	res := append([]Migration(nil), migrations...)
+	sort.Stable(migrationsByOrder(res))
+	if hasDependencies(res) {
+		res = sortDependencies(res)
 	}
+	return res
+}
+
+// FindUnrolled finds migrations that were not rolled back, in the order set
+// by SetOrderBy.
+func (sch *Schema) FindUnrolled(migrations []Migration) (res []Migration, err error) {
+	return sch.FindUnrolledContext(context.Background(), migrations)
+}
 
-	if err := rows.Err(); err != nil {
+// FindUnrolledContext is like FindUnrolled but uses ctx for the query.
+func (sch *Schema) FindUnrolledContext(ctx context.Context, migrations []Migration) (res []Migration, err error) {
+	set, err := NewMigrationSet(migrations)
+	if err != nil {
 		return nil, err
 	}
 
-	for _, name := range resNames {
-		if _, ok := migByName[name]; !ok {
-			delete(migByName, name)
+	return sch.FindUnrolledSetContext(ctx, set)
+}
+
+// FindUnrolledSet is like FindUnrolled but takes an already validated set.
+func (sch *Schema) FindUnrolledSet(set *MigrationSet) (res []Migration, err error) {
+	return sch.FindUnrolledSetContext(context.Background(), set)
+}
+
+// FindUnrolledSetContext is like FindUnrolledSet but uses ctx for the query.
+func (sch *Schema) FindUnrolledSetContext(ctx context.Context, set *MigrationSet) (res []Migration, err error) {
+	if set.Len() == 0 {
+		return nil, nil
+	}
+
+	if sch.orderColumn == OrderByAppliedAt {
+		names, err := sch.queryNames(ctx, sch.orderByClause(), 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			if m := set.ByName(name); m != nil {
+				res = append(res, m)
+			}
 		}
+
+		return res, nil
 	}
 
-	for _, m := range migByName {
-		res = append(res, m)
+	applied, err := sch.queryAppliedNames(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	sort.Sort(migrationsByNameDesc(res))
+	for i := range set.migrations {
+		m := set.migrations[i]
+		if sch.orderDesc {
+			m = set.migrations[len(set.migrations)-1-i]
+		}
+		if applied[m.Name()] {
+			res = append(res, m)
+		}
+	}
 
 	return res, nil
 }
+
+// FindOrphans finds names of applied migrations missing from migrations,
+// sorted by name.
+func (sch *Schema) FindOrphans(migrations []Migration) ([]string, error) {
+	return sch.FindOrphansContext(context.Background(), migrations)
+}
+
+// FindOrphansContext is like FindOrphans but uses ctx for the query.
+func (sch *Schema) FindOrphansContext(ctx context.Context, migrations []Migration) ([]string, error) {
+	set, err := NewMigrationSet(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := sch.queryAppliedNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return orphans(set, applied), nil
+}
+
+// orphans returns the names in applied missing from set, sorted by name.
+func orphans(set *MigrationSet, applied map[string]bool) []string {
+	var res []string
+	for name := range applied {
+		if set.ByName(name) == nil {
+			res = append(res, name)
+		}
+	}
+
+	sort.Strings(res)
+
+	return res
+}
+
+// ErrUnknownApplied is returned by FindUnapplied in strict mode and by Reset
+// when some of the applied migrations are missing from the code.
+type ErrUnknownApplied struct {
+	Names []string
+}
+
+// Error implements the error interface for ErrUnknownApplied.
+func (err ErrUnknownApplied) Error() string {
+	return fmt.Sprintf("unknown applied migrations: %s", strings.Join(err.Names, ", "))
+}
+
+var _ error = ErrUnknownApplied{}
+
+// SetStrictMode makes FindUnapplied return ErrUnknownApplied when some of the
+// applied migrations are missing from the ones passed to it, which usually
+// means an older binary runs against a newer database. It's disabled by
+// default.
+func (sch *Schema) SetStrictMode(enabled bool) {
+	sch.strict = enabled
+}
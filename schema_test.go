@@ -0,0 +1,441 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTable is the key of the default migrations table in fakeDB.
+const testTable = DefaultSchemaName + "." + DefaultMigrationTableName
+
+// newTestSchema returns a Schema with an initialized migrations table in a
+// new fakeDB.
+func newTestSchema(t testing.TB) (*Schema, *fakeDB) {
+	db, fdb := newFakeDB(t)
+	sch := NewSchema(db, DefaultSchemaName, DefaultMigrationTableName)
+	if err := sch.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return sch, fdb
+}
+
+// testMigration returns a migration running the statements "APPLY name",
+// "UNDO name", "DRY APPLY name" and "DRY UNDO name".
+func testMigration(name string) Struct {
+	exec := func(q string) func(tx *sql.Tx) error {
+		return func(tx *sql.Tx) error {
+			_, err := tx.Exec(q)
+			return err
+		}
+	}
+	return Struct{
+		NameString:      name,
+		ApplyFunc:       exec("APPLY " + name),
+		RollbackFunc:    exec("UNDO " + name),
+		ApplyDryFunc:    exec("DRY APPLY " + name),
+		RollbackDryFunc: exec("DRY UNDO " + name),
+	}
+}
+
+// testMigrations returns testMigration of every name.
+func testMigrations(names ...string) []Migration {
+	res := make([]Migration, 0, len(names))
+	for _, name := range names {
+		res = append(res, testMigration(name))
+	}
+	return res
+}
+
+func TestApplyDry(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		isDry       bool
+		wantRun     []string
+		wantApplied []string
+	}{
+		{
+			name:        "apply",
+			wantRun:     []string{"APPLY 1", "APPLY 2"},
+			wantApplied: []string{"1", "2"},
+		},
+		{
+			name:    "dry",
+			isDry:   true,
+			wantRun: []string{"DRY APPLY 1", "DRY APPLY 2"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sch, db := newTestSchema(t)
+			migs := testMigrations("2", "1")
+
+			apply := sch.Apply
+			if tt.isDry {
+				apply = sch.ApplyDry
+			}
+			n, err := apply(migs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 2 {
+				t.Errorf("got %d migrations, want 2", n)
+			}
+
+			run := append(db.executed("APPLY "), db.executed("DRY APPLY ")...)
+			if !reflect.DeepEqual(run, tt.wantRun) {
+				t.Errorf("ran %q, want %q", run, tt.wantRun)
+			}
+			if got := db.names(testTable); !reflect.DeepEqual(got, tt.wantApplied) {
+				t.Errorf("recorded %q, want %q", got, tt.wantApplied)
+			}
+		})
+	}
+}
+
+func TestRollbackDry(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		isDry       bool
+		wantRun     []string
+		wantApplied []string
+	}{
+		{
+			name:    "rollback",
+			wantRun: []string{"UNDO 2", "UNDO 1"},
+		},
+		{
+			name:        "dry",
+			isDry:       true,
+			wantRun:     []string{"DRY UNDO 2", "DRY UNDO 1"},
+			wantApplied: []string{"1", "2"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sch, db := newTestSchema(t)
+			migs := testMigrations("1", "2")
+			if _, err := sch.Apply(migs); err != nil {
+				t.Fatal(err)
+			}
+
+			rollback := sch.Rollback
+			if tt.isDry {
+				rollback = sch.RollbackDry
+			}
+			n, err := rollback(migs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 2 {
+				t.Errorf("got %d migrations, want 2", n)
+			}
+
+			run := append(db.executed("UNDO "), db.executed("DRY UNDO ")...)
+			if !reflect.DeepEqual(run, tt.wantRun) {
+				t.Errorf("ran %q, want %q", run, tt.wantRun)
+			}
+			if got := db.names(testTable); !reflect.DeepEqual(got, tt.wantApplied) {
+				t.Errorf("recorded %q, want %q", got, tt.wantApplied)
+			}
+		})
+	}
+}
+
+// orderedMigration is a testMigration with an explicit order.
+type orderedMigration struct {
+	Struct
+	order int
+}
+
+func (m orderedMigration) Order() int {
+	return m.order
+}
+
+func TestOrdered(t *testing.T) {
+	sch, db := newTestSchema(t)
+	migs := []Migration{
+		orderedMigration{testMigration("create_users"), 1},
+		orderedMigration{testMigration("add_login"), 2},
+		testMigration("zero"),
+		orderedMigration{testMigration("backfill"), 3},
+	}
+	wantApplied := []string{"zero", "create_users", "add_login", "backfill"}
+
+	unapplied, err := sch.FindUnapplied(migs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := migrationNames(unapplied); !reflect.DeepEqual(got, wantApplied) {
+		t.Errorf("FindUnapplied returned %q, want %q", got, wantApplied)
+	}
+
+	if _, err := sch.Apply(migs); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.names(testTable); !reflect.DeepEqual(got, wantApplied) {
+		t.Errorf("applied %q, want %q", got, wantApplied)
+	}
+
+	unrolled, err := sch.FindUnrolled(migs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantUnrolled := []string{"backfill", "add_login", "create_users", "zero"}
+	if got := migrationNames(unrolled); !reflect.DeepEqual(got, wantUnrolled) {
+		t.Errorf("FindUnrolled returned %q, want %q", got, wantUnrolled)
+	}
+}
+
+// migrationNames returns the names of migrations.
+func migrationNames(migrations []Migration) []string {
+	var res []string
+	for _, m := range migrations {
+		res = append(res, m.Name())
+	}
+	return res
+}
+
+func TestApplySkipsApplied(t *testing.T) {
+	variants := []struct {
+		name  string
+		apply func(sch *Schema, migs []Migration) (int, error)
+	}{
+		{name: "Apply", apply: (*Schema).Apply},
+		{name: "ApplyEach", apply: (*Schema).ApplyEach},
+		{
+			name: "ApplyTx",
+			apply: func(sch *Schema, migs []Migration) (int, error) {
+				tx, err := sch.db.BeginTx(context.Background(), nil)
+				if err != nil {
+					return 0, err
+				}
+				n, err := sch.ApplyTx(tx, migs)
+				if err != nil {
+					tx.Rollback()
+					return 0, err
+				}
+				return n, tx.Commit()
+			},
+		},
+		{
+			name: "MultiSchema.Apply",
+			apply: func(sch *Schema, migs []Migration) (int, error) {
+				ms, err := NewMultiSchema(sch)
+				if err != nil {
+					return 0, err
+				}
+				counts, err := ms.Apply([][]Migration{migs})
+				return counts[0], err
+			},
+		},
+	}
+
+	for _, v := range variants {
+		for _, requireNew := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/requireNew=%t", v.name, requireNew), func(t *testing.T) {
+				sch, db := newTestSchema(t)
+				if _, err := sch.Apply(testMigrations("1")); err != nil {
+					t.Fatal(err)
+				}
+				sch.SetRequireNew(requireNew)
+
+				n, err := v.apply(sch, testMigrations("1", "2"))
+				if requireNew {
+					var fe fakeError
+					if !errors.As(err, &fe) || fe.SQLState() != "23505" {
+						t.Fatalf("got %v, want a unique violation", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if n != 1 {
+					t.Errorf("applied %d migrations, want 1", n)
+				}
+				want := []string{"APPLY 1", "APPLY 2"}
+				if got := db.executed("APPLY "); !reflect.DeepEqual(got, want) {
+					t.Errorf("ran %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkApply compares applying 100 migrations recording each of them with
+// a statement of its own to recording them in a batch, like Apply does, with
+// every statement taking a round trip of 100µs.
+func BenchmarkApply(b *testing.B) {
+	const n = 100
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("%03d", i)
+	}
+	migs := testMigrations(names...)
+
+	for _, bench := range []struct {
+		name    string
+		batched bool
+	}{
+		{name: "unbatched"},
+		{name: "batched", batched: true},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			ctx := context.Background()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				sch, fdb := newTestSchema(b)
+				fdb.delay = 100 * time.Microsecond
+				b.StartTimer()
+
+				tx, err := sch.db.BeginTx(ctx, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				var batch *recordBatch
+				if bench.batched {
+					batch = &recordBatch{}
+				}
+				now := time.Now()
+				for _, m := range migs {
+					if err := sch.applyOne(ctx, tx, m, now, false, batch, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if batch != nil {
+					if err := sch.flushBatch(ctx, tx, batch); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := tx.Commit(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkFindUnapplied finds the unapplied ones among 1000 migrations with
+// a growing number of applied migrations, most of them unknown to the set.
+func BenchmarkFindUnapplied(b *testing.B) {
+	var names []string
+	for i := 0; i < 1000; i++ {
+		names = append(names, fmt.Sprintf("%05d", i))
+	}
+	migs := testMigrations(names...)
+
+	for _, applied := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("applied=%d", applied), func(b *testing.B) {
+			sch, fdb := newTestSchema(b)
+			for i := 0; i < applied; i++ {
+				fdb.insertRaw(testTable, fakeRow{"name": fmt.Sprintf("%05d", 2*i)})
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := sch.FindUnapplied(migs); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestInitUpgrade(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		cols    ColumnConfig
+		wantErr error
+	}{
+		{
+			name: "optional columns",
+		},
+		{
+			name:    "missing name",
+			cols:    ColumnConfig{Name: "version"},
+			wantErr: ErrMissingColumn{Name: "version"},
+		},
+		{
+			name:    "missing applied_at",
+			cols:    ColumnConfig{AppliedAt: "created_at"},
+			wantErr: ErrMissingColumn{Name: "created_at"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fdb := newFakeDB(t)
+			_, err := db.Exec(`CREATE TABLE ` + testTable + ` (name TEXT UNIQUE, applied_at TIMESTAMP)`)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sch := NewSchema(db, DefaultSchemaName, DefaultMigrationTableName)
+			if err := sch.SetColumns(tt.cols); err != nil {
+				t.Fatal(err)
+			}
+			err = sch.Init()
+			if err != tt.wantErr {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+
+			var added []string
+			for _, q := range fdb.executed("ALTER TABLE") {
+				added = append(added, strings.Fields(q)[5])
+			}
+			var want []string
+			if tt.wantErr == nil {
+				want = []string{`"checksum"`, `"duration_ms"`, `"id"`, `"source"`}
+			}
+			if !reflect.DeepEqual(added, want) {
+				t.Errorf("added %q, want %q", added, want)
+			}
+		})
+	}
+}
+
+func TestNilMigration(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		run  func(sch *Schema, migs []Migration) error
+	}{
+		{
+			name: "Apply",
+			run: func(sch *Schema, migs []Migration) error {
+				_, err := sch.Apply(migs)
+				return err
+			},
+		},
+		{
+			name: "Rollback",
+			run: func(sch *Schema, migs []Migration) error {
+				_, err := sch.Rollback(migs)
+				return err
+			},
+		},
+		{
+			name: "FindUnapplied",
+			run: func(sch *Schema, migs []Migration) error {
+				_, err := sch.FindUnapplied(migs)
+				return err
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sch, db := newTestSchema(t)
+			migs := []Migration{testMigration("1"), nil, testMigration("2")}
+
+			err := tt.run(sch, migs)
+			if err != (ErrNilMigration{Index: 1}) {
+				t.Errorf("got %v, want ErrNilMigration at index 1", err)
+			}
+			if got := db.executed("APPLY "); len(got) > 0 {
+				t.Errorf("ran %q, want nothing", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package migration
+
+// MigrationSet is a validated set of migrations sorted by order and name.
+type MigrationSet struct {
+	migrations []Migration
+	byName     map[string]Migration
+}
+
+// NewMigrationSet returns a new MigrationSet. It returns ErrNilMigration,
+// ErrEmptyName, ErrNameNotUnique or ErrDependencyCycle if some of the
+// migrations are invalid.
+func NewMigrationSet(migrations []Migration) (*MigrationSet, error) {
+	byName, err := indexByName(migrations)
+	if err != nil {
+		return nil, err
+	}
+	err = checkDependencies(migrations, byName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MigrationSet{
+		migrations: SortMigrations(migrations),
+		byName:     byName,
+	}, nil
+}
+
+// Len returns the number of migrations in the set.
+func (set *MigrationSet) Len() int {
+	return len(set.migrations)
+}
+
+// Names returns the names of the migrations in order.
+func (set *MigrationSet) Names() []string {
+	names := make([]string, 0, len(set.migrations))
+	for _, m := range set.migrations {
+		names = append(names, m.Name())
+	}
+	return names
+}
+
+// ByName returns the migration named name or nil if there is none.
+func (set *MigrationSet) ByName(name string) Migration {
+	return set.byName[name]
+}
+
+// Slice returns the migrations in order.
+func (set *MigrationSet) Slice() []Migration {
+	return append([]Migration(nil), set.migrations...)
+}
@@ -0,0 +1,48 @@
+package migration
+
+import "context"
+
+// Simulate applies the unapplied migrations for real, including their
+// records, in a transaction that is always rolled back. Unlike ApplyDry, the
+// SQL actually runs, so it reports the errors the database would. It goes
+// through the same steps as Apply: names are validated, the transaction lock
+// is taken, migrations applied meanwhile are skipped, Validator migrations
+// are validated and ignored SQL states are honored. With auto initialization
+// the migrations table is created in the transaction too, so nothing
+// persists. It stops at the first failing migration, returning
+// ErrMigrationFailed, since the ones after it may depend on it.
+// NonTransactional migrations can't be rolled back and make it return
+// ErrNonTransactional without running anything. The logger and the
+// per-migration hooks are called as in Apply, but not the hooks around the
+// commit.
+func (sch *Schema) Simulate(migrations []Migration) error {
+	return sch.SimulateContext(context.Background(), migrations)
+}
+
+// SimulateContext is like Simulate but uses ctx for the queries and the
+// transaction.
+func (sch *Schema) SimulateContext(ctx context.Context, migrations []Migration) error {
+	err := validate(migrations)
+	if err != nil {
+		return err
+	}
+	err = sch.validateNames(migrations)
+	if err != nil {
+		return err
+	}
+
+	// A missing migrations table means nothing is applied, like in a dry run.
+	migs, _, err := sch.skipApplied(ctx, SortMigrations(migrations), true)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migs {
+		if isNonTransactional(m) {
+			return ErrNonTransactional{Name: m.Name()}
+		}
+	}
+
+	_, err = sch.applyTx(ctx, migs, sch.clock.Now(), txSimulate, nil)
+	return err
+}
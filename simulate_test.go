@@ -0,0 +1,69 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		init        bool
+		applied     []string
+		wantRun     []string
+		wantApplied []string
+	}{
+		{
+			name:    "auto init",
+			wantRun: []string{"APPLY 1", "APPLY 2"},
+		},
+		{
+			name:        "skips applied",
+			init:        true,
+			applied:     []string{"1"},
+			wantRun:     []string{"APPLY 2"},
+			wantApplied: []string{"1"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fdb := newFakeDB(t)
+			sch := NewSchema(db, DefaultSchemaName, DefaultMigrationTableName)
+			sch.SetAutoInit(true)
+			if tt.init {
+				if _, err := sch.Apply(testMigrations(tt.applied...)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var locked bool
+			fdb.setHook(func(q string) error {
+				if q == "SELECT pg_advisory_xact_lock($1)" {
+					locked = true
+				}
+				return nil
+			})
+
+			if err := sch.Simulate(testMigrations("1", "2")); err != nil {
+				t.Fatal(err)
+			}
+
+			run := fdb.executed("APPLY ")[len(tt.applied):]
+			if !reflect.DeepEqual(run, tt.wantRun) {
+				t.Errorf("ran %q, want %q", run, tt.wantRun)
+			}
+			if !locked {
+				t.Error("Simulate didn't take the transaction lock")
+			}
+			if got := fdb.names(testTable); !reflect.DeepEqual(got, tt.wantApplied) {
+				t.Errorf("recorded %q, want %q", got, tt.wantApplied)
+			}
+			exists, err := sch.Exists()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists != tt.init {
+				t.Errorf("migrations table exists: %t, want %t", exists, tt.init)
+			}
+		})
+	}
+}
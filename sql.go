@@ -0,0 +1,131 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// SQLer is a Migration applied by running a SQL script, which PlanSQL shows
+// without running it.
+type SQLer interface {
+	Migration
+
+	UpSQL() string
+}
+
+// SQLMigration is a Migration running SQL scripts. Blank scripts are not
+// executed. An irreversible SQLMigration needs no Down. FromFS and FromFSTree
+// return SQLMigration values.
+type SQLMigration struct {
+	NameString     string
+	Up             string
+	Down           string
+	IsIrreversible bool
+	TagList        []string
+	Description    string
+}
+
+// Apply implements Migration for SQLMigration.
+func (m SQLMigration) Apply(tx *sql.Tx) error {
+	return m.ApplyContext(context.Background(), tx)
+}
+
+// Rollback implements Migration for SQLMigration.
+func (m SQLMigration) Rollback(tx *sql.Tx) error {
+	return m.RollbackContext(context.Background(), tx)
+}
+
+// ApplyContext implements ContextMigration for SQLMigration.
+func (m SQLMigration) ApplyContext(ctx context.Context, tx *sql.Tx) error {
+	_, err := execRows(ctx, tx, m.Up)
+	return err
+}
+
+// RollbackContext implements ContextMigration for SQLMigration.
+func (m SQLMigration) RollbackContext(ctx context.Context, tx *sql.Tx) error {
+	if m.IsIrreversible {
+		return ErrIrreversible{Name: m.NameString}
+	}
+	_, err := execRows(ctx, tx, m.Down)
+	return err
+}
+
+// Name implements Migration for SQLMigration.
+func (m SQLMigration) Name() string {
+	return m.NameString
+}
+
+// ApplyRows implements RowsMigration for SQLMigration. What a script of
+// several statements reports depends on the driver, and it's -1 if the driver
+// reports nothing, e.g. after DDL.
+func (m SQLMigration) ApplyRows(ctx context.Context, tx *sql.Tx) (int64, error) {
+	return execRows(ctx, tx, m.Up)
+}
+
+// execRows executes the script q unless it's blank and returns the number of
+// affected rows, or -1 if the driver can't tell.
+func execRows(ctx context.Context, tx *sql.Tx, q string) (int64, error) {
+	if strings.TrimSpace(q) == "" {
+		return 0, nil
+	}
+
+	res, err := tx.ExecContext(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+
+	// Drivers return driver.ResultNoRows after DDL, which has no count.
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, nil
+	}
+	return n, nil
+}
+
+// UpSQL implements SQLer for SQLMigration.
+func (m SQLMigration) UpSQL() string {
+	return m.Up
+}
+
+// Irreversible implements IrreversibleMigration for SQLMigration.
+func (m SQLMigration) Irreversible() bool {
+	return m.IsIrreversible
+}
+
+// Tags implements Tagged for SQLMigration.
+func (m SQLMigration) Tags() []string {
+	return m.TagList
+}
+
+var _ Migration = SQLMigration{}
+var _ ContextMigration = SQLMigration{}
+var _ SQLer = SQLMigration{}
+var _ RowsMigration = SQLMigration{}
+var _ IrreversibleMigration = SQLMigration{}
+var _ Tagged = SQLMigration{}
+
+// SetSQLRewriter sets a function transforming the SQL of every SQLer before
+// it's applied, e.g. to substitute the schema name or add comments. The
+// rewritten script is executed in place of Apply, and PlanSQL shows it. Other
+// migrations can't be rewritten and are applied as is, and so are rollbacks.
+// If the rewriter returns an error, the migration fails with it.
+func (sch *Schema) SetSQLRewriter(rewrite func(name, sql string) (string, error)) {
+	sch.sqlRewriter = rewrite
+}
+
+// rewrittenSQL returns the SQL of m passed through the rewriter and whether
+// m is rewritten at all, which requires m to be a SQLer and the rewriter to
+// be set.
+func (sch *Schema) rewrittenSQL(m Migration) (string, bool, error) {
+	s, ok := m.(SQLer)
+	if !ok || sch.sqlRewriter == nil {
+		return "", false, nil
+	}
+
+	q, err := sch.sqlRewriter(m.Name(), s.UpSQL())
+	if err != nil {
+		return "", true, err
+	}
+	return q, true, nil
+}
@@ -0,0 +1,76 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSQLMigrationContext(t *testing.T) {
+	sqlDB, db := newFakeDB(t)
+	m := SQLMigration{NameString: "1", Up: "APPLY 1", Down: "UNDO 1"}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, tt := range []struct {
+		name    string
+		ctx     context.Context
+		f       func(ctx context.Context, tx *sql.Tx) error
+		wantErr error
+		wantRun []string
+	}{
+		{name: "apply", ctx: context.Background(), f: m.ApplyContext, wantRun: []string{"APPLY 1"}},
+		{name: "rollback", ctx: context.Background(), f: m.RollbackContext, wantRun: []string{"UNDO 1"}},
+		{name: "apply canceled", ctx: canceled, f: m.ApplyContext, wantErr: context.Canceled},
+		{name: "rollback canceled", ctx: canceled, f: m.RollbackContext, wantErr: context.Canceled},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := sqlDB.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			before := len(db.executed(""))
+			err = tt.f(tt.ctx, tx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+
+			run := db.executed("")[before:]
+			if len(run) == 0 {
+				run = nil
+			}
+			if !reflect.DeepEqual(run, tt.wantRun) {
+				t.Errorf("ran %q, want %q", run, tt.wantRun)
+			}
+		})
+	}
+}
+
+func TestSQLMigrationRowsAffected(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		up       string
+		wantRows map[string]int64
+	}{
+		{name: "DDL", up: "CREATE TABLE t (id int)"},
+		{name: "DML", up: "APPLY 1", wantRows: map[string]int64{"1": 0}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sch, _ := newTestSchema(t)
+			m := SQLMigration{NameString: "1", Up: tt.up}
+
+			res, err := sch.ApplyResult([]Migration{m})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(res.RowsAffected, tt.wantRows) {
+				t.Errorf("got rows affected %v, want %v", res.RowsAffected, tt.wantRows)
+			}
+		})
+	}
+}
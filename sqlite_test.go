@@ -0,0 +1,122 @@
+//go:build sqlite
+
+// The tests in this file run against a real SQLite database. They need cgo
+// and github.com/mattn/go-sqlite3 and run with go test -tags sqlite.
+
+package migration
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newSQLiteSchema returns a Schema in the SQLite dialect on a new database
+// file.
+func newSQLiteSchema(t *testing.T) (*Schema, *sql.DB) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	sch := NewSchema(db, DefaultSchemaName, DefaultMigrationTableName)
+	sch.SetDialect(SQLiteDialect{})
+	return sch, db
+}
+
+func TestSQLite(t *testing.T) {
+	migs := []Migration{
+		SQLMigration{
+			NameString: "1_users",
+			Up:         "CREATE TABLE users (id INTEGER PRIMARY KEY, login TEXT NOT NULL)",
+			Down:       "DROP TABLE users",
+		},
+		SQLMigration{
+			NameString: "2_admin",
+			Up:         "INSERT INTO users (login) VALUES ('admin')",
+			Down:       "DELETE FROM users WHERE login = 'admin'",
+		},
+	}
+
+	for _, savepoints := range []bool{false, true} {
+		name := "batch"
+		if savepoints {
+			name = "savepoints"
+		}
+		t.Run(name, func(t *testing.T) {
+			sch, db := newSQLiteSchema(t)
+			sch.SetSavepoints(savepoints)
+
+			// The second Init reads the columns and adds none.
+			for i := 0; i < 2; i++ {
+				if err := sch.Init(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			exists, err := sch.Exists()
+			if err != nil || !exists {
+				t.Fatalf("got %t, %v, want the migrations table to exist", exists, err)
+			}
+
+			res, err := sch.ApplyResult(migs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantRows := map[string]int64{"2_admin": 1}
+			if !reflect.DeepEqual(res.RowsAffected, wantRows) {
+				t.Errorf("got rows affected %v, want %v", res.RowsAffected, wantRows)
+			}
+
+			unapplied, err := sch.FindUnapplied(migs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(unapplied) > 0 {
+				t.Errorf("got unapplied %q, want none", migrationNames(unapplied))
+			}
+
+			applied, err := sch.ListApplied()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, a := range applied {
+				names = append(names, a.Name)
+			}
+			if want := []string{"1_users", "2_admin"}; !reflect.DeepEqual(names, want) {
+				t.Errorf("listed %q, want %q", names, want)
+			}
+
+			if err := sch.Verify(migs); err != nil {
+				t.Error(err)
+			}
+			if err := sch.VerifyIntegrity(); err != nil {
+				t.Error(err)
+			}
+
+			if n, err := sch.RollbackN(migs, 1); err != nil || n != 1 {
+				t.Fatalf("RollbackN returned %d, %v, want 1", n, err)
+			}
+			var users int
+			if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&users); err != nil {
+				t.Fatal(err)
+			}
+			if users != 0 {
+				t.Errorf("got %d users after RollbackN, want 0", users)
+			}
+
+			if n, err := sch.Reset(migs); err != nil || n != 1 {
+				t.Fatalf("Reset returned %d, %v, want 1", n, err)
+			}
+			if applied, err := sch.ListApplied(); err != nil || len(applied) > 0 {
+				t.Errorf("got %v, %v after Reset, want nothing applied", applied, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MigrationStatus is the state of a single migration in the database.
+type MigrationStatus struct {
+	Name      string
+	Applied   bool
+	AppliedAt time.Time // zero if the migration is pending
+}
+
+// Status returns the status of every migration in migrations, in the same
+// order.
+func (sch *Schema) Status(migrations []Migration) ([]MigrationStatus, error) {
+	return sch.StatusContext(context.Background(), migrations)
+}
+
+// StatusContext is like Status but uses ctx for the query.
+func (sch *Schema) StatusContext(ctx context.Context, migrations []Migration) ([]MigrationStatus, error) {
+	appliedAt, err := sch.queryApplied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		t, ok := appliedAt[m.Name()]
+		res = append(res, MigrationStatus{
+			Name:      m.Name(),
+			Applied:   ok,
+			AppliedAt: t,
+		})
+	}
+
+	return res, nil
+}
+
+// AppliedMigration is a row of the migrations table.
+type AppliedMigration struct {
+	Name      string
+	AppliedAt time.Time
+	Duration  time.Duration // zero if not recorded
+	Source    string        // empty if not recorded, see SetSource
+}
+
+// ListApplied returns every migration recorded in the migrations table,
+// including those missing from the code, in the order they were applied.
+func (sch *Schema) ListApplied() ([]AppliedMigration, error) {
+	return sch.ListAppliedContext(context.Background())
+}
+
+// ListAppliedContext is like ListApplied but uses ctx for the query.
+func (sch *Schema) ListAppliedContext(ctx context.Context) ([]AppliedMigration, error) {
+	return sch.listApplied(ctx, sch.queries.list)
+}
+
+// AppliedBetween returns the migrations applied between from and to
+// inclusive, in the order they were applied, e.g. to match schema changes
+// with an incident timeline.
+func (sch *Schema) AppliedBetween(from, to time.Time) ([]AppliedMigration, error) {
+	return sch.AppliedBetweenContext(context.Background(), from, to)
+}
+
+// AppliedBetweenContext is like AppliedBetween but uses ctx for the query.
+func (sch *Schema) AppliedBetweenContext(ctx context.Context, from, to time.Time) ([]AppliedMigration, error) {
+	return sch.listApplied(ctx, sch.queries.between, from, to)
+}
+
+// listApplied returns the records selected by q, which selects the columns of
+// the list query.
+func (sch *Schema) listApplied(ctx context.Context, q string, args ...interface{}) (res []AppliedMigration, err error) {
+	rows, err := sch.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		closeErr := rows.Close()
+		if closeErr != nil {
+			if err != nil {
+				err = ErrorPair{Err1: err, Err2: closeErr}
+			} else {
+				err = closeErr
+			}
+		}
+	}()
+
+	for rows.Next() {
+		am, err := scanApplied(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, am)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// FindOneApplied returns the record of the migration named name from the
+// migrations table, whether or not the migration is still in the code. It
+// returns ErrNotApplied if the migration is not applied.
+func (sch *Schema) FindOneApplied(name string) (AppliedMigration, error) {
+	return sch.FindOneAppliedContext(context.Background(), name)
+}
+
+// FindOneAppliedContext is like FindOneApplied but uses ctx for the query.
+func (sch *Schema) FindOneAppliedContext(ctx context.Context, name string) (AppliedMigration, error) {
+	am, err := scanApplied(sch.db.QueryRowContext(ctx, sch.queries.one, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return AppliedMigration{}, ErrNotApplied{Name: name}
+	}
+	return am, err
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanApplied scans a record selected by the list or one query.
+func scanApplied(row rowScanner) (AppliedMigration, error) {
+	var am AppliedMigration
+	var appliedAt sql.NullTime
+	var durationMS sql.NullInt64
+	var source sql.NullString
+	if err := row.Scan(&am.Name, &appliedAt, &durationMS, &source); err != nil {
+		return AppliedMigration{}, err
+	}
+
+	am.AppliedAt = appliedAt.Time
+	am.Duration = time.Duration(durationMS.Int64) * time.Millisecond
+	am.Source = source.String
+	return am, nil
+}
+
+// Version returns the name of the most recently applied migration, in the
+// order of RollbackN, or an empty string if none is applied.
+func (sch *Schema) Version() (string, error) {
+	return sch.VersionContext(context.Background())
+}
+
+// VersionContext is like Version but uses ctx for the query.
+func (sch *Schema) VersionContext(ctx context.Context) (string, error) {
+	names, err := sch.queryLastApplied(ctx, 1)
+	if err != nil || len(names) == 0 {
+		return "", err
+	}
+	return names[0], nil
+}
+
+// queryApplied returns applied_at of every row in the migrations table by
+// name.
+func (sch *Schema) queryApplied(ctx context.Context) (map[string]time.Time, error) {
+	applied, err := sch.ListAppliedContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]time.Time, len(applied))
+	for _, am := range applied {
+		res[am.Name] = am.AppliedAt
+	}
+
+	return res, nil
+}
+
+// Pending returns the number of unapplied migrations.
+func (sch *Schema) Pending(migrations []Migration) (int, error) {
+	return sch.PendingContext(context.Background(), migrations)
+}
+
+// PendingContext is like Pending but uses ctx for the query.
+func (sch *Schema) PendingContext(ctx context.Context, migrations []Migration) (int, error) {
+	if _, err := indexByName(migrations); err != nil {
+		return 0, err
+	}
+
+	applied, err := sch.queryAppliedNames(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, m := range migrations {
+		if !applied[m.Name()] {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// HasPending reports whether there are unapplied migrations.
+func (sch *Schema) HasPending(migrations []Migration) (bool, error) {
+	return sch.HasPendingContext(context.Background(), migrations)
+}
+
+// HasPendingContext is like HasPending but uses ctx for the query.
+func (sch *Schema) HasPendingContext(ctx context.Context, migrations []Migration) (bool, error) {
+	n, err := sch.PendingContext(ctx, migrations)
+	return n > 0, err
+}
+
+// ErrPendingMigrations is returned by Check when some migrations are not
+// applied.
+type ErrPendingMigrations struct {
+	Names []string
+}
+
+// Error implements the error interface for ErrPendingMigrations.
+func (err ErrPendingMigrations) Error() string {
+	return fmt.Sprintf("pending migrations: %s", strings.Join(err.Names, ", "))
+}
+
+var _ error = ErrPendingMigrations{}
+
+// Check returns ErrPendingMigrations listing the unapplied migrations in order
+// if there are any. It only reads the migrations table, never creating it or
+// taking locks, so it suits startup checks of applications that are migrated
+// separately. A missing migrations table means nothing is applied.
+func (sch *Schema) Check(migrations []Migration) error {
+	return sch.CheckContext(context.Background(), migrations)
+}
+
+// CheckContext is like Check but uses ctx for the queries.
+func (sch *Schema) CheckContext(ctx context.Context, migrations []Migration) error {
+	if _, err := indexByName(migrations); err != nil {
+		return err
+	}
+
+	exists, err := sch.tableExists(ctx)
+	if err != nil {
+		return err
+	}
+
+	applied := map[string]bool{}
+	if exists {
+		applied, err = sch.queryAppliedNames(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	var names []string
+	for _, m := range SortMigrations(migrations) {
+		if !applied[m.Name()] {
+			names = append(names, m.Name())
+		}
+	}
+
+	if len(names) > 0 {
+		return ErrPendingMigrations{Names: names}
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrInvalidCount is returned by ApplyN and RollbackN when the count is not
+// positive.
+var ErrInvalidCount = errors.New("migration count must be positive")
+
+// ApplyN applies the first n unapplied migrations in a single transaction. If
+// there are less than n unapplied migrations, all of them are applied. It
+// returns the number of applied migrations and error if any.
+func (sch *Schema) ApplyN(migrations []Migration, n int) (int, error) {
+	return sch.ApplyNContext(context.Background(), migrations, n)
+}
+
+// ApplyNContext is like ApplyN but uses ctx for the queries and the
+// transaction.
+func (sch *Schema) ApplyNContext(ctx context.Context, migrations []Migration, n int) (int, error) {
+	if n <= 0 {
+		return 0, ErrInvalidCount
+	}
+
+	migs, err := sch.FindUnappliedContext(ctx, migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(migs) > n {
+		migs = migs[:n]
+	}
+
+	return sch.ApplyContext(ctx, migs)
+}
+
+// ApplyTo applies unapplied migrations up to and including the one named
+// targetName in a single transaction. If the target is already applied, it
+// does nothing. It returns ErrMigrationNotFound if there is no target in
+// migrations.
+func (sch *Schema) ApplyTo(migrations []Migration, targetName string) (int, error) {
+	return sch.ApplyToContext(context.Background(), migrations, targetName)
+}
+
+// ApplyToContext is like ApplyTo but uses ctx for the queries and the
+// transaction.
+func (sch *Schema) ApplyToContext(ctx context.Context, migrations []Migration, targetName string) (int, error) {
+	if FindByName(migrations, targetName) == nil {
+		return 0, ErrMigrationNotFound
+	}
+
+	migs, err := sch.FindUnappliedContext(ctx, migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, m := range migs {
+		if m.Name() == targetName {
+			return sch.ApplyContext(ctx, migs[:i+1])
+		}
+	}
+
+	return 0, nil
+}
+
+// ApplyTag applies unapplied migrations Tagged with tag in a single
+// transaction, in order. Other migrations are left untouched. It returns the
+// number of applied migrations and error if any.
+func (sch *Schema) ApplyTag(migrations []Migration, tag string) (int, error) {
+	return sch.ApplyTagContext(context.Background(), migrations, tag)
+}
+
+// ApplyTagContext is like ApplyTag but uses ctx for the queries and the
+// transaction.
+func (sch *Schema) ApplyTagContext(ctx context.Context, migrations []Migration, tag string) (int, error) {
+	migs, err := sch.FindUnappliedContext(ctx, migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	var tagged []Migration
+	for _, m := range migs {
+		if hasTag(m, tag) {
+			tagged = append(tagged, m)
+		}
+	}
+
+	return sch.ApplyContext(ctx, tagged)
+}
+
+// RollbackN rolls back the n most recently applied migrations in a single
+// transaction, most recent first, by the id column. Records made before Init
+// added it are ordered by applied_at, then by name. If less than n migrations
+// are applied, all of them are rolled back. Every migration to roll back must
+// be present in migrations. It returns the number of rolled back migrations
+// and error if any.
+func (sch *Schema) RollbackN(migrations []Migration, n int) (int, error) {
+	return sch.RollbackNContext(context.Background(), migrations, n)
+}
+
+// RollbackNContext is like RollbackN but uses ctx for the queries and the
+// transaction.
+func (sch *Schema) RollbackNContext(ctx context.Context, migrations []Migration, n int) (int, error) {
+	if n <= 0 {
+		return 0, ErrInvalidCount
+	}
+
+	migByName, err := indexByName(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	names, err := sch.queryLastApplied(ctx, n)
+	if err != nil {
+		return 0, err
+	}
+
+	migs, err := appliedByNames(migByName, names)
+	if err != nil {
+		return 0, err
+	}
+
+	return sch.rollbackInOrder(ctx, migs)
+}
+
+// RollbackTo rolls back every applied migration that comes after targetName
+// in a single transaction, in reverse order. The target itself stays applied.
+// It returns ErrMigrationNotFound if there is no target in migrations or if
+// a migration applied after it is missing from them, and ErrNotApplied if the
+// target is not applied. Applied migrations missing from migrations that were
+// applied before the target are left alone.
+func (sch *Schema) RollbackTo(migrations []Migration, targetName string) (int, error) {
+	return sch.RollbackToContext(context.Background(), migrations, targetName)
+}
+
+// RollbackToContext is like RollbackTo but uses ctx for the queries and the
+// transaction.
+func (sch *Schema) RollbackToContext(ctx context.Context, migrations []Migration, targetName string) (int, error) {
+	set, err := NewMigrationSet(migrations)
+	if err != nil {
+		return 0, err
+	}
+	if set.ByName(targetName) == nil {
+		return 0, ErrMigrationNotFound
+	}
+
+	names, err := sch.queryNames(ctx, sch.applyOrderClause(false), 0)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := make(map[string]bool, len(names))
+	target := -1
+	for i, name := range names {
+		applied[name] = true
+		if name == targetName {
+			target = i
+		}
+	}
+
+	if target < 0 {
+		return 0, ErrNotApplied{Name: targetName}
+	}
+
+	// Only the migrations applied after the target need their code.
+	for _, name := range names[target+1:] {
+		if set.ByName(name) == nil {
+			return 0, fmt.Errorf("applied migration %q: %w", name, ErrMigrationNotFound)
+		}
+	}
+
+	var migs []Migration
+	for i := len(set.migrations) - 1; i >= 0; i-- {
+		m := set.migrations[i]
+		if m.Name() == targetName {
+			break
+		}
+		if applied[m.Name()] {
+			migs = append(migs, m)
+		}
+	}
+
+	return sch.rollbackInOrder(ctx, migs)
+}
+
+// appliedByNames looks up applied migrations by names. It returns
+// ErrMigrationNotFound if some of them are missing from migByName.
+func appliedByNames(migByName map[string]Migration, names []string) ([]Migration, error) {
+	migs := make([]Migration, 0, len(names))
+	for _, name := range names {
+		m, ok := migByName[name]
+		if !ok {
+			return nil, fmt.Errorf("applied migration %q: %w", name, ErrMigrationNotFound)
+		}
+		migs = append(migs, m)
+	}
+	return migs, nil
+}
+
+// queryLastApplied returns names of the n most recently applied migrations,
+// or of all of them if n is zero, most recent first.
+func (sch *Schema) queryLastApplied(ctx context.Context, n int) ([]string, error) {
+	return sch.queryNames(ctx, sch.applyOrderClause(true), n)
+}
+
+// Reset rolls back every applied migration in a single transaction, most
+// recently applied first like RollbackN, whatever order SetOrderBy sets for
+// FindUnrolled. Applied migrations missing from migrations can't be rolled
+// back, so if there are any, it returns ErrUnknownApplied listing them
+// without rolling back anything, unless SetForceRollbackOrphans is enabled. It
+// returns the number of rolled back migrations and error if any.
+func (sch *Schema) Reset(migrations []Migration) (int, error) {
+	return sch.ResetContext(context.Background(), migrations)
+}
+
+// ResetContext is like Reset but uses ctx for the queries and the
+// transaction.
+func (sch *Schema) ResetContext(ctx context.Context, migrations []Migration) (int, error) {
+	set, err := NewMigrationSet(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	applied, err := sch.queryLastApplied(ctx, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	var migs []Migration
+	var names []string
+	for _, name := range applied {
+		if m := set.ByName(name); m != nil {
+			migs = append(migs, m)
+		} else {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	if len(names) > 0 && !sch.forceOrphans {
+		return 0, ErrUnknownApplied{Names: names}
+	}
+
+	n := 0
+	if len(migs) > 0 {
+		n, err = sch.rollbackInOrder(ctx, migs)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, sch.unrecordOrphans(ctx, names)
+}
+
+// SetForceRollbackOrphans makes Reset delete the records of applied
+// migrations missing from the code after rolling back the others, rather than
+// return ErrUnknownApplied. Their code is gone, so nothing else is rolled
+// back for them, and they aren't counted. It's disabled by default; use
+// FindOrphans to see what would be deleted.
+func (sch *Schema) SetForceRollbackOrphans(enabled bool) {
+	sch.forceOrphans = enabled
+}
+
+// unrecordOrphans deletes the records of the migrations named names in a
+// single transaction.
+func (sch *Schema) unrecordOrphans(ctx context.Context, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	_, err := sch.withLock(ctx, func() (n int, err error) {
+		tx, err := beginTx(ctx, sch.db, sch.txOptions())
+		if err != nil {
+			return 0, err
+		}
+
+		defer func() {
+			err = endTx(ctx, tx, err, err == nil)
+		}()
+
+		err = sch.prepareTx(ctx, tx, false)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, name := range names {
+			_, err = tx.ExecContext(ctx, sch.queries.delete, name)
+			if err != nil {
+				return 0, failed(name, OpUnrecord, err)
+			}
+		}
+		return 0, nil
+	})
+	return err
+}
+
+// Migrate initializes the migrations table and applies unapplied migrations
+// in a single transaction, holding the lock throughout if auto locking is
+// enabled and retrying as set by SetRetry. It returns the number of applied
+// migrations and error if any.
+func (sch *Schema) Migrate(migrations []Migration) (int, error) {
+	return sch.MigrateContext(context.Background(), migrations)
+}
+
+// MigrateContext is like Migrate but uses ctx for the queries and the
+// transaction.
+func (sch *Schema) MigrateContext(ctx context.Context, migrations []Migration) (int, error) {
+	res := &Result{StartedAt: sch.clock.Now()}
+	n, err := sch.withLock(ctx, func() (int, error) {
+		err := sch.InitContext(ctx)
+		if err != nil {
+			return 0, err
+		}
+
+		migs, err := sch.FindUnappliedContext(ctx, migrations)
+		if err != nil {
+			return 0, err
+		}
+
+		n, retries, err := sch.withRetry(ctx, func() (int, error) {
+			return sch.apply(ctx, migs, false, res)
+		})
+		res.Retries = retries
+		return n, err
+	})
+
+	res.FinishedAt = sch.clock.Now()
+	if err == nil {
+		sch.notifyCommit(res)
+	}
+
+	return n, err
+}
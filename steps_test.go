@@ -0,0 +1,161 @@
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRollbackTo(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		before      string // orphan recorded before the migrations
+		apply       []string
+		after       string // orphan recorded after the migrations
+		target      string
+		wantErr     error
+		wantApplied []string
+	}{
+		{
+			name:        "rollback",
+			apply:       []string{"1", "2", "3"},
+			target:      "1",
+			wantApplied: []string{"1"},
+		},
+		{
+			name:        "orphan before target",
+			before:      "0",
+			apply:       []string{"1", "2", "3"},
+			target:      "2",
+			wantApplied: []string{"0", "1", "2"},
+		},
+		{
+			name:        "orphan after target",
+			apply:       []string{"1", "2", "3"},
+			after:       "4",
+			target:      "2",
+			wantErr:     ErrMigrationNotFound,
+			wantApplied: []string{"1", "2", "3", "4"},
+		},
+		{
+			name:        "target not applied",
+			apply:       []string{"1", "2"},
+			target:      "3",
+			wantErr:     ErrNotApplied{Name: "3"},
+			wantApplied: []string{"1", "2"},
+		},
+		{
+			name:        "target missing",
+			before:      "0",
+			apply:       []string{"1", "2", "3"},
+			target:      "0",
+			wantErr:     ErrMigrationNotFound,
+			wantApplied: []string{"0", "1", "2", "3"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sch, db := newTestSchema(t)
+			markApplied(t, sch, tt.before)
+			if _, err := sch.Apply(testMigrations(tt.apply...)); err != nil {
+				t.Fatal(err)
+			}
+			markApplied(t, sch, tt.after)
+
+			_, err := sch.RollbackTo(testMigrations("1", "2", "3"), tt.target)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if got := db.names(testTable); !reflect.DeepEqual(got, tt.wantApplied) {
+				t.Errorf("applied %q, want %q", got, tt.wantApplied)
+			}
+		})
+	}
+}
+
+// markApplied marks the migration named name applied unless name is empty.
+func markApplied(t *testing.T, sch *Schema, name string) {
+	t.Helper()
+	if name == "" {
+		return
+	}
+	if err := sch.MarkApplied(name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResetOrder(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		column OrderColumn
+		desc   bool
+	}{
+		{name: "name desc", column: OrderByName, desc: true},
+		{name: "name asc", column: OrderByName},
+		{name: "applied_at desc", column: OrderByAppliedAt, desc: true},
+		{name: "applied_at asc", column: OrderByAppliedAt},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sch, db := newTestSchema(t)
+			if err := sch.SetOrderBy(tt.column, tt.desc); err != nil {
+				t.Fatal(err)
+			}
+
+			migs := testMigrations("1", "2", "3")
+			if _, err := sch.Apply(migs); err != nil {
+				t.Fatal(err)
+			}
+
+			n, err := sch.Reset(migs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 3 {
+				t.Errorf("rolled back %d migrations, want 3", n)
+			}
+
+			want := []string{"UNDO 3", "UNDO 2", "UNDO 1"}
+			if got := db.executed("UNDO "); !reflect.DeepEqual(got, want) {
+				t.Errorf("ran %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestResetOrphans(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		force       bool
+		wantErr     error
+		wantApplied []string
+	}{
+		{
+			name:        "orphans",
+			wantErr:     ErrUnknownApplied{Names: []string{"0", "4"}},
+			wantApplied: []string{"0", "1", "2", "4"},
+		},
+		{
+			name:  "forced",
+			force: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sch, db := newTestSchema(t)
+			sch.SetForceRollbackOrphans(tt.force)
+
+			migs := testMigrations("1", "2")
+			markApplied(t, sch, "0")
+			if _, err := sch.Apply(migs); err != nil {
+				t.Fatal(err)
+			}
+			markApplied(t, sch, "4")
+
+			_, err := sch.Reset(migs)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if got := db.names(testTable); !reflect.DeepEqual(got, tt.wantApplied) {
+				t.Errorf("applied %q, want %q", got, tt.wantApplied)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ErrMigrationTimeout is returned when applying a migration takes longer than
+// its timeout.
+type ErrMigrationTimeout struct {
+	Name    string
+	Timeout time.Duration
+}
+
+// Error implements the error interface for ErrMigrationTimeout.
+func (err ErrMigrationTimeout) Error() string {
+	return fmt.Sprintf("migration %q timed out after %s", err.Name, err.Timeout)
+}
+
+var _ error = ErrMigrationTimeout{}
+
+// Timed is a Migration with its own timeout overriding the one set with
+// SetMigrationTimeout. A zero timeout means no timeout.
+type Timed interface {
+	Migration
+
+	Timeout() time.Duration
+}
+
+// SetMigrationTimeout sets the default time applying a single migration may
+// take. The context passed to ContextMigration and NonTransactional
+// migrations gets the deadline, so their statements are cancelled once it's
+// reached; other migrations can't be interrupted and fail only after they
+// return. Either way Apply fails with ErrMigrationTimeout wrapped in
+// ErrMigrationFailed and the transaction is rolled back. Zero, the default,
+// means no timeout.
+func (sch *Schema) SetMigrationTimeout(d time.Duration) {
+	sch.migTimeout = d
+}
+
+// timeoutOf returns the timeout of m.
+func (sch *Schema) timeoutOf(m Migration) time.Duration {
+	if t, ok := m.(Timed); ok {
+		return t.Timeout()
+	}
+	return sch.migTimeout
+}
+
+// withTimeout calls f with ctx limited by the timeout of m, returning
+// ErrMigrationTimeout if it's exceeded.
+func (sch *Schema) withTimeout(ctx context.Context, m Migration, f func(ctx context.Context) error) error {
+	timeout := sch.timeoutOf(m)
+	if timeout <= 0 {
+		return f(ctx)
+	}
+
+	mctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := f(mctx)
+	if ctx.Err() == nil && (mctx.Err() != nil || time.Since(start) > timeout) {
+		return ErrMigrationTimeout{Name: m.Name(), Timeout: timeout}
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package migration
+
+import "context"
+
+// Span is a tracing span started by a Tracer.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	End(err error)
+}
+
+// Tracer starts tracing spans. It's easily adapted to an OpenTelemetry tracer
+// without making this package depend on it.
+//
+// Schema starts a "migration.apply_batch" or "migration.rollback_batch" span
+// for every batch of Apply, ApplyEach, ApplyOne, Rollback and their variants,
+// with the "migration.dry" attribute telling whether it's a dry run and the
+// "migration.count" attribute set, once it ends, to the number of migrations
+// committed, or run in a dry run. Within it, and in ApplyTx, MultiSchema and
+// Simulate, it starts a "migration.apply" or "migration.rollback" span for
+// every migration, with the "migration.name" attribute, which ends before the
+// migration is committed, if it ever is.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(key string, value interface{}) {}
+func (nopSpan) End(err error)                              {}
+
+var _ Span = nopSpan{}
+
+// SetTracer sets the tracer. A nil tracer disables tracing, which is the
+// default.
+func (sch *Schema) SetTracer(t Tracer) {
+	sch.tracer = t
+}
+
+// startBatch starts a batch span named name. The returned function ends it
+// with the number n of migrations committed, or run if isDry is true.
+func (sch *Schema) startBatch(ctx context.Context, name string, isDry bool) (context.Context, func(n int, err error)) {
+	ctx, span := sch.startSpan(ctx, name)
+	span.SetAttribute("migration.dry", isDry)
+	return ctx, func(n int, err error) {
+		span.SetAttribute("migration.count", n)
+		span.End(err)
+	}
+}
+
+// startSpan starts a span if a tracer is set.
+func (sch *Schema) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if sch.tracer == nil {
+		return ctx, nopSpan{}
+	}
+	return sch.tracer.Start(ctx, name)
+}
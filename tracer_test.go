@@ -0,0 +1,87 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// recordingTracer records the batch spans it started once they end.
+type recordingTracer struct {
+	mu      sync.Mutex
+	batches []recordedBatch
+}
+
+type recordedBatch struct {
+	name   string
+	dry    bool
+	count  int
+	failed bool
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	batch  recordedBatch
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, &recordingSpan{tracer: t, batch: recordedBatch{name: name}}
+}
+
+func (s *recordingSpan) SetAttribute(key string, value interface{}) {
+	switch key {
+	case "migration.dry":
+		s.batch.dry = value.(bool)
+	case "migration.count":
+		s.batch.count = value.(int)
+	}
+}
+
+func (s *recordingSpan) End(err error) {
+	if s.batch.name != "migration.apply_batch" && s.batch.name != "migration.rollback_batch" {
+		return
+	}
+	s.batch.failed = err != nil
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.batches = append(s.tracer.batches, s.batch)
+}
+
+func TestBatchSpans(t *testing.T) {
+	sch, fdb := newTestSchema(t)
+	tr := &recordingTracer{}
+	sch.SetTracer(tr)
+
+	migs := testMigrations("1", "2")
+	if _, err := sch.ApplyDry(migs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sch.Apply(migs[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	fdb.setHook(func(q string) error {
+		if q == "APPLY 3" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	if _, err := sch.Apply(testMigrations("1", "2", "3")); err == nil {
+		t.Fatal("Apply didn't fail")
+	}
+	if _, err := sch.Rollback(migs[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []recordedBatch{
+		{name: "migration.apply_batch", dry: true, count: 2},
+		{name: "migration.apply_batch", count: 1},
+		{name: "migration.apply_batch", failed: true},
+		{name: "migration.rollback_batch", count: 1},
+	}
+	if !reflect.DeepEqual(tr.batches, want) {
+		t.Errorf("got batches %+v, want %+v", tr.batches, want)
+	}
+}
@@ -0,0 +1,73 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+)
+
+// ApplyTx applies migrations in tx, which is owned by the caller: it's neither
+// committed nor rolled back, whatever happens. The migrations are recorded in
+// the same transaction, which takes the transaction lock first like Apply.
+// Migrations that are already applied, as seen in tx, are skipped like in
+// Apply. NonTransactional migrations are not supported.
+// It returns the number of applied migrations and error if any.
+func (sch *Schema) ApplyTx(tx *sql.Tx, migrations []Migration) (int, error) {
+	return sch.ApplyTxContext(context.Background(), tx, migrations)
+}
+
+// ApplyTxContext is like ApplyTx but uses ctx for every statement.
+func (sch *Schema) ApplyTxContext(ctx context.Context, tx *sql.Tx, migrations []Migration) (int, error) {
+	err := validate(migrations)
+	if err != nil {
+		return 0, err
+	}
+	err = sch.validateNames(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	migrations = SortMigrations(migrations)
+	for _, m := range migrations {
+		if isNonTransactional(m) {
+			return 0, ErrNonTransactional{Name: m.Name()}
+		}
+	}
+
+	err = sch.lockTx(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	if !sch.requireNew {
+		migrations, _, err = sch.skipAppliedIn(ctx, tx, migrations)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = validateAll(tx, migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	now := sch.clock.Now()
+	batch := &recordBatch{}
+	for _, m := range migrations {
+		err = ctx.Err()
+		if err != nil {
+			return 0, err
+		}
+
+		err = sch.applyOne(ctx, tx, m, now, false, batch, nil)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = sch.flushBatch(ctx, tx, batch)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(migrations), nil
+}